@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// See https://docs.anthropic.com/en/api/messages
+const anthropicApiKey = "ANTHROPIC_API_KEY"
+
+// ANTHROPIC_BASE_URL is the same variable the official SDKs use; handy for
+// pointing at a local stand-in server
+const anthropicBaseURLEnv = "ANTHROPIC_BASE_URL"
+const anthropicDefaultBaseURL = "https://api.anthropic.com"
+const anthropicVersion = "2023-06-01"
+const anthropicDefaultModel = "claude-sonnet-4-20250514"
+
+// max_tokens is required by the Messages API
+const anthropicDefaultMaxTokens = 4096
+
+type anthropicProvider struct{}
+
+func init() {
+	RegisterProvider(anthropicProvider{})
+}
+
+func (anthropicProvider) Name() string   { return "Anthropic" }
+func (anthropicProvider) Flag() string   { return "a" }
+func (anthropicProvider) EnvKey() string { return anthropicApiKey }
+
+func (anthropicProvider) Capabilities() Capabilities {
+	return Capabilities{Stream: true, Params: ParamSupport{Temperature: true, MaxTokens: true, TopP: true, Stop: true, MaxTemperature: 1}}
+}
+
+type AnthropicRequest struct {
+	Model         string    `json:"model"`
+	MaxTokens     int       `json:"max_tokens"`
+	System        string    `json:"system,omitempty"`
+	Messages      []Message `json:"messages"`
+	Stream        bool      `json:"stream,omitempty"`
+	Temperature   *float64  `json:"temperature,omitempty"`
+	TopP          *float64  `json:"top_p,omitempty"`
+	StopSequences []string  `json:"stop_sequences,omitempty"`
+}
+
+type AnthropicContentBlock struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type AnthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+type AnthropicResponse struct {
+	ID           string                  `json:"id"`
+	Type         string                  `json:"type"`
+	Role         string                  `json:"role"`
+	Model        string                  `json:"model"`
+	Content      []AnthropicContentBlock `json:"content"`
+	StopReason   string                  `json:"stop_reason"`
+	StopSequence string                  `json:"stop_sequence"`
+	Usage        AnthropicUsage          `json:"usage"`
+}
+
+// AnthropicStreamEvent covers the fields we need from each streamed event
+type AnthropicStreamEvent struct {
+	Type    string            `json:"type"`
+	Message AnthropicResponse `json:"message"`
+	Delta   struct {
+		Type       string `json:"type"`
+		Text       string `json:"text"`
+		StopReason string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage AnthropicUsage `json:"usage"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+type AnthropicError struct {
+	Type  string `json:"type"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// anthropicBaseURL returns the API address, which can be overridden with ANTHROPIC_BASE_URL
+func anthropicBaseURL() string {
+	return ResolveBaseURL(anthropicProvider{}.Name(), anthropicBaseURLEnv, anthropicDefaultBaseURL)
+}
+
+func AnthropicGenResponseMock() *AnthropicResponse {
+	return &AnthropicResponse{
+		ID:    "msg_mock_123",
+		Type:  "message",
+		Role:  "assistant",
+		Model: anthropicDefaultModel,
+		Content: []AnthropicContentBlock{
+			{Type: "text", Text: "This is a mocked Anthropic response."},
+		},
+		StopReason: "end_turn",
+		Usage: AnthropicUsage{
+			InputTokens:  10,
+			OutputTokens: 5,
+		},
+	}
+}
+
+// anthropicPost sends a request to the Messages API, returning the response
+// if it was successful
+func anthropicPost(ctx context.Context, anthropicRequest AnthropicRequest) (*http.Response, error) {
+	jsonData, err := json.Marshal(anthropicRequest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, anthropicBaseURL()+"/v1/messages", bytes.NewReader(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	key, err := RequireAPIKey(anthropicApiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Add("x-api-key", key)
+	req.Header.Add("anthropic-version", anthropicVersion)
+	req.Header.Add("Content-Type", "application/json")
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+
+		statusErr := &HTTPStatusError{StatusCode: res.StatusCode, Status: res.Status, Header: res.Header, Message: strings.TrimSpace(string(body))}
+
+		var apiErr AnthropicError
+		if json.Unmarshal(body, &apiErr) == nil && apiErr.Error.Message != "" {
+			statusErr.Message = apiErr.Error.Type + ": " + apiErr.Error.Message
+		}
+		return nil, statusErr
+	}
+
+	return res, nil
+}
+
+// anthropicRequest builds the request for req; the system prompt has its
+// own field rather than being a message
+func anthropicRequest(req Request, stream bool) AnthropicRequest {
+	maxTokens := anthropicDefaultMaxTokens
+	if req.Params.MaxTokens != nil {
+		maxTokens = *req.Params.MaxTokens
+	}
+
+	return AnthropicRequest{
+		Model:         req.ModelOr(anthropicDefaultModel),
+		MaxTokens:     maxTokens,
+		System:        req.System,
+		Messages:      req.Conversation(),
+		Stream:        stream,
+		Temperature:   req.Params.Temperature,
+		TopP:          req.Params.TopP,
+		StopSequences: req.Params.Stop,
+	}
+}
+
+// AnthropicCallAPI calls the Anthropic Messages API
+func AnthropicCallAPI(ctx context.Context, request AnthropicRequest, mock bool) (*AnthropicResponse, error) {
+	if mock {
+		return AnthropicGenResponseMock(), nil
+	}
+
+	res, err := anthropicPost(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var response AnthropicResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w\nResponse was: %s", err, body)
+	}
+
+	return &response, nil
+}
+
+func (anthropicProvider) Complete(ctx context.Context, req Request) (ModelResponse, error) {
+	c, err := AnthropicCallAPI(ctx, anthropicRequest(req, false), req.Mock)
+	if err != nil {
+		return ModelResponse{}, err
+	}
+
+	return modelResponseFromAnthropic(c), nil
+}
+
+// Stream assembles a response from the message_start, content_block_delta
+// and message_delta events
+func (anthropicProvider) Stream(ctx context.Context, req Request, onToken func(string)) (ModelResponse, error) {
+	res, err := anthropicPost(ctx, anthropicRequest(req, true))
+	if err != nil {
+		return ModelResponse{}, err
+	}
+	defer res.Body.Close()
+
+	var message AnthropicResponse
+	var content strings.Builder
+
+	err = readSSE(res.Body, func(event string, data string) error {
+		var streamEvent AnthropicStreamEvent
+		if err := json.Unmarshal([]byte(data), &streamEvent); err != nil {
+			return fmt.Errorf("failed to unmarshal event: %w\nEvent was: %s", err, data)
+		}
+
+		switch streamEvent.Type {
+		case "message_start":
+			message = streamEvent.Message
+		case "content_block_delta":
+			if streamEvent.Delta.Type == "text_delta" {
+				content.WriteString(streamEvent.Delta.Text)
+				onToken(streamEvent.Delta.Text)
+			}
+		case "message_delta":
+			message.StopReason = streamEvent.Delta.StopReason
+			message.Usage.OutputTokens = streamEvent.Usage.OutputTokens
+		case "error":
+			return fmt.Errorf("%s: %s", streamEvent.Error.Type, streamEvent.Error.Message)
+		}
+		return nil
+	})
+	if err != nil {
+		return ModelResponse{}, err
+	}
+
+	message.Content = []AnthropicContentBlock{{Type: "text", Text: content.String()}}
+	return modelResponseFromAnthropic(&message), nil
+}
+
+func modelResponseFromAnthropic(c *AnthropicResponse) ModelResponse {
+	// Only text blocks are of interest, there are no tools in play
+	var contentBuilder strings.Builder
+	for _, block := range c.Content {
+		if block.Type == "text" {
+			contentBuilder.WriteString(block.Text)
+		}
+	}
+
+	// Anthropic's input tokens are only those after the cache
+	promptTokens := c.Usage.InputTokens + c.Usage.CacheCreationInputTokens + c.Usage.CacheReadInputTokens
+
+	return ModelResponse{
+		Model:            c.Model,
+		TotalTokens:      promptTokens + c.Usage.OutputTokens,
+		PromptTokens:     promptTokens,
+		CompletionTokens: c.Usage.OutputTokens,
+		CachedTokens:     c.Usage.CacheReadInputTokens,
+		Content:          contentBuilder.String(),
+		FinishReason:     c.StopReason,
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAnthropicProvider(t *testing.T) {
+	quietMode = true
+	response, duration, err := CompleteProvider(context.Background(), anthropicProvider{}, Request{Prompt: "Mock prompt", Mock: true}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Render(FmtModelResponse(anthropicProvider{}.Name(), response, duration, quietMode))
+}
+
+func TestAnthropicCallAPI(t *testing.T) {
+	t.Setenv(anthropicApiKey, "test-api-key")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" {
+			t.Errorf("Expected path /v1/messages, got %s", r.URL.Path)
+		}
+		if r.Header.Get("x-api-key") != "test-api-key" {
+			t.Errorf("Expected x-api-key header test-api-key, got %s", r.Header.Get("x-api-key"))
+		}
+		if r.Header.Get("anthropic-version") == "" {
+			t.Error("Expected an anthropic-version header")
+		}
+
+		var request AnthropicRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		if request.Model != "claude-test" {
+			t.Errorf("Expected model claude-test, got %s", request.Model)
+		}
+		if request.MaxTokens == 0 {
+			t.Error("Expected max_tokens to be set")
+		}
+		if request.System != "Be brief" || len(request.Messages) != 1 {
+			t.Errorf("Expected the system prompt in its own field, got %q and %+v", request.System, request.Messages)
+		}
+
+		w.Write([]byte(`{
+			"id": "msg_test",
+			"type": "message",
+			"role": "assistant",
+			"model": "claude-test",
+			"content": [{"type": "text", "text": "Hello "}, {"type": "text", "text": "there"}],
+			"stop_reason": "end_turn",
+			"usage": {"input_tokens": 2, "output_tokens": 8, "cache_read_input_tokens": 10}
+		}`))
+	}))
+	defer server.Close()
+
+	t.Setenv(anthropicBaseURLEnv, server.URL)
+
+	response, err := anthropicProvider{}.Complete(context.Background(), Request{Prompt: "Hi", Model: "claude-test", System: "Be brief"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if response.Content != "Hello there" {
+		t.Errorf("Unexpected content %q", response.Content)
+	}
+	if response.TotalTokens != 20 {
+		t.Errorf("Expected 20 tokens, got %d", response.TotalTokens)
+	}
+	// The cache reads are part of the prompt
+	if response.PromptTokens != 12 || response.CachedTokens != 10 || response.CompletionTokens != 8 {
+		t.Errorf("Expected 12 in of which 10 cached and 8 out, got %+v", response)
+	}
+	if response.FinishReason != "end_turn" {
+		t.Errorf("Expected end_turn, got %s", response.FinishReason)
+	}
+}
+
+func TestAnthropicCallAPIError(t *testing.T) {
+	t.Setenv(anthropicApiKey, "test-api-key")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"type":"error","error":{"type":"invalid_request_error","message":"bad model"}}`))
+	}))
+	defer server.Close()
+
+	t.Setenv(anthropicBaseURLEnv, server.URL)
+
+	if _, err := (anthropicProvider{}).Complete(context.Background(), Request{Prompt: "Hi"}); err == nil {
+		t.Error("Expected an error for a 400 response")
+	}
+}
+
+func TestAnthropicStream(t *testing.T) {
+	t.Setenv(anthropicApiKey, "test-api-key")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request AnthropicRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		if !request.Stream {
+			t.Error("Expected stream to be true")
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(`event: message_start
+data: {"type":"message_start","message":{"id":"msg_test","model":"claude-test","usage":{"input_tokens":12,"output_tokens":1}}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello "}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"there"}}
+
+event: message_delta
+data: {"type":"message_delta","delta":{"stop_reason":"end_turn"},"usage":{"output_tokens":8}}
+
+event: message_stop
+data: {"type":"message_stop"}
+
+`))
+	}))
+	defer server.Close()
+
+	t.Setenv(anthropicBaseURLEnv, server.URL)
+
+	var tokens []string
+	response, err := anthropicProvider{}.Stream(context.Background(), Request{Prompt: "Hi"}, func(token string) {
+		tokens = append(tokens, token)
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(tokens) != 2 {
+		t.Errorf("Expected 2 tokens, got %q", tokens)
+	}
+	if response.Content != "Hello there" || response.TotalTokens != 20 || response.FinishReason != "end_turn" {
+		t.Errorf("Unexpected response %+v", response)
+	}
+}
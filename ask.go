@@ -0,0 +1,456 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errProvidersFailed is returned by ask when providers failed in a way
+// --fail-on cares about; the failures have already been reported
+var errProvidersFailed = errors.New("providers failed")
+
+// askOptions are the flags of the ask command
+type askOptions struct {
+	selected   []Provider
+	logToJsonl bool
+	stream     bool
+	failOn     string
+	noContext  bool
+	force      bool
+	system     systemOptions
+	params     GenerationParams
+	// Model overrides, keyed by lower case provider name
+	models   map[string]string
+	timeouts map[string]time.Duration
+
+	// What prepare resolved from the options and config
+	systemPrompt string
+	genParams    GenerationParams
+	contextFiles []ContextFile
+	// budget is what's left of the budget, if one is set
+	budget *Budget
+	// session and turn say where requests go in the conversation
+	session string
+	turn    int
+	// resumed is true when carrying on a session from the log, which is
+	// where the follow up has to go too
+	resumed bool
+	// warned records the providers we've warned about ignored params
+	warned map[string]bool
+}
+
+// selectProvider adds p to the selection, once
+func (opts *askOptions) selectProvider(p Provider) {
+	for _, each := range opts.selected {
+		if each == p {
+			return
+		}
+	}
+	opts.selected = append(opts.selected, p)
+}
+
+// newAskFlags returns the flags of the ask command, which fill in opts and
+// the shared settings such as quietMode and perplexityOptions
+func newAskFlags(opts *askOptions) (*flag.FlagSet, error) {
+	fs := flag.NewFlagSet("ask", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	fs.BoolVar(&opts.logToJsonl, "l", false, "enable logging of model interactions to ~/gollm_logs.jsonl")
+	fs.BoolVar(&opts.logToJsonl, "log", false, "enable logging of model interactions to ~/gollm_logs.jsonl")
+	fs.BoolVar(&quietMode, "q", false, "quiet mode: turns off logging and all non-essential output")
+	fs.BoolVar(&quietMode, "quiet", false, "quiet mode: turns off logging and all non-essential output")
+
+	fs.Func("provider", "use these comma separated `providers`, by name", func(value string) error {
+		for _, name := range splitList(value) {
+			p, ok := LookupProvider(name)
+			if !ok {
+				return fmt.Errorf("unknown provider %q", name)
+			}
+			opts.selectProvider(p)
+		}
+		return nil
+	})
+	fs.Func("model", "use this `model`, or per provider with e.g. gemini=...,chatgpt=...", func(value string) error {
+		return ParseModelFlag(value, opts.models)
+	})
+	fs.StringVar(&opts.system.text, "system", "", "send this system `prompt` to every provider")
+	fs.StringVar(&opts.system.file, "system-file", "", "send the contents of this `file` as the system prompt")
+	fs.StringVar(&opts.system.persona, "persona", "", "send the system prompt of this `persona` from the config")
+	fs.Func("temperature", "sample at this `temperature`, from 0 to 2", func(value string) error {
+		return parseFloatParam(value, &opts.params.Temperature)
+	})
+	fs.Func("max-tokens", "generate at most `n` tokens", func(value string) error {
+		return parseIntParam(value, &opts.params.MaxTokens)
+	})
+	fs.Func("top-p", "sample from the tokens making up this much `probability`, up to 1", func(value string) error {
+		return parseFloatParam(value, &opts.params.TopP)
+	})
+	fs.Func("stop", "stop when this `sequence` is generated, can be repeated", func(value string) error {
+		opts.params.Stop = append(opts.params.Stop, value)
+		return nil
+	})
+	fs.Func("seed", "sample with this `seed`, for more repeatable answers", func(value string) error {
+		return parseSeedParam(value, &opts.params.Seed)
+	})
+	fs.BoolVar(&opts.noContext, "no-context", false, "don't put the context files from the config before the prompt")
+	fs.BoolVar(&opts.force, "force", false, "send the prompt even if it would go over a budget")
+	fs.BoolVar(&opts.stream, "stream", false, "print tokens as they arrive rather than rendering markdown at the end")
+	fs.Func("fail-on", "exit non-zero when `any|all|none|providers` fail, default any", func(value string) error {
+		if err := ValidateFailOn(value); err != nil {
+			return err
+		}
+		opts.failOn = value
+		return nil
+	})
+	fs.IntVar(&retryPolicy.MaxRetries, "retries", DefaultRetryPolicy.MaxRetries, fmt.Sprintf("retry rate limited and failed calls up to `n` times, default %d", DefaultRetryPolicy.MaxRetries))
+	fs.Func("timeout", fmt.Sprintf("give up on a provider after this `duration`, e.g. 90s, or per provider with e.g. ollama=30m, default %s", defaultTimeout), func(value string) error {
+		return ParseTimeoutFlag(value, opts.timeouts)
+	})
+
+	// Perplexity's search options
+	fs.Func("search-allow", "only search these comma separated `domains` (Perplexity)", func(value string) error {
+		perplexityOptions.AllowDomains = splitList(value)
+		return nil
+	})
+	fs.Func("search-deny", "never search these comma separated `domains` (Perplexity)", func(value string) error {
+		perplexityOptions.DenyDomains = splitList(value)
+		return nil
+	})
+	fs.StringVar(&perplexityOptions.Recency, "search-recency", perplexityOptions.Recency, "only search results from the last `day|week|month|year` (Perplexity)")
+	fs.StringVar(&perplexityOptions.ContextSize, "search-context", perplexityOptions.ContextSize, "use a `low|medium|high` amount of search context (Perplexity)")
+	fs.BoolVar(&perplexityOptions.ReturnImages, "search-images", perplexityOptions.ReturnImages, "include image URLs in the answer (Perplexity)")
+	fs.BoolVar(&perplexityOptions.RelatedQuestions, "related-questions", perplexityOptions.RelatedQuestions, "include related questions in the answer (Perplexity)")
+	fs.StringVar(&perplexityOptions.SystemPrompt, "perplexity-system", perplexityOptions.SystemPrompt, "Perplexity's own system `prompt`, used unless one is given with --system etc")
+
+	// Each provider can be selected by its flag, e.g. -g, and they compose
+	for _, p := range Providers() {
+		if fs.Lookup(p.Flag()) != nil {
+			return nil, fmt.Errorf("provider %s can't use the flag -%s as it is taken by an option", p.Name(), p.Flag())
+		}
+		fs.BoolFunc(p.Flag(), "use "+p.Name(), func(string) error {
+			opts.selectProvider(p)
+			return nil
+		})
+	}
+
+	return fs, nil
+}
+
+// isProviderFlag is true if f selects a provider rather than being an option
+func isProviderFlag(f *flag.Flag) bool {
+	_, ok := FindProviderByFlag(f.Name, "")
+	return ok
+}
+
+// parseInterspersed parses fs from args, allowing flags after the positional
+// arguments, e.g. gollm "Summarize this" -c, and returns the positional ones.
+// Everything after -- is positional
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+
+		rest := fs.Args()
+		consumed := args[:len(args)-len(rest)]
+		if len(rest) == 0 || len(consumed) > 0 && consumed[len(consumed)-1] == "--" {
+			return append(positional, rest...), nil
+		}
+
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+// newAskOptions returns the options before any flags are parsed
+func newAskOptions() askOptions {
+	return askOptions{
+		failOn:   "any",
+		models:   map[string]string{},
+		timeouts: map[string]time.Duration{},
+		warned:   map[string]bool{},
+		session:  NewSessionID(),
+		turn:     1,
+	}
+}
+
+// prepare checks the options and resolves them against the config: which
+// providers to use, the system prompt, params and context files. It prints
+// the status header as it goes
+func (opts *askOptions) prepare(cfg Config) error {
+	if retryPolicy.MaxRetries < 0 {
+		return fmt.Errorf("--retries should be a number of retries, not %d", retryPolicy.MaxRetries)
+	}
+	if err := perplexityOptions.Validate(); err != nil {
+		return err
+	}
+	var err error
+	if opts.systemPrompt, err = opts.system.Resolve(cfg); err != nil {
+		return err
+	}
+	opts.genParams = cfg.Params.Override(opts.params)
+	if err := opts.genParams.Validate(); err != nil {
+		return err
+	}
+
+	// A resumed session lives in the log, and calls have to be logged to
+	// count against a budget, so both log even when quiet
+	var mustLog string
+	switch {
+	case opts.resumed:
+		mustLog = "the session is resumed"
+	case cfg.Budget.IsSet():
+		mustLog = "a budget is set"
+	}
+
+	if mustLog != "" {
+		opts.logToJsonl = true
+		if quietMode {
+			fmt.Fprintf(os.Stderr, "Logging in quiet mode as %s\n", mustLog)
+		}
+	} else if quietMode && opts.logToJsonl {
+		opts.logToJsonl = false
+		fmt.Fprintf(os.Stderr, "Not logging as quiet mode activated\n")
+	}
+
+	if cfg.Budget.IsSet() {
+		if opts.budget, err = LoadBudget(cfg, time.Now()); err != nil {
+			return err
+		}
+	}
+
+	for _, p := range opts.selected {
+		Print("Using " + p.Name())
+	}
+
+	// Let the user know if we're logging
+	if opts.logToJsonl {
+		Print("Logging")
+	}
+
+	if opts.system.persona != "" {
+		Print("Persona " + opts.system.persona)
+	}
+
+	// If none explicitly selected then use the configured defaults
+	if len(opts.selected) == 0 {
+		for _, name := range cfg.DefaultProviders {
+			p, ok := LookupProvider(name)
+			if !ok {
+				return fmt.Errorf("unknown provider %q in default_providers", name)
+			}
+			opts.selectProvider(p)
+		}
+	}
+
+	// Otherwise use all we have keys for, bar the local ones
+	if len(opts.selected) == 0 {
+		for _, p := range Providers() {
+			if !p.Capabilities().Local && HaveAPIKey(p) {
+				opts.selected = append(opts.selected, p)
+			}
+		}
+
+		if len(opts.selected) == 0 {
+			return fmt.Errorf("no API keys set, see %s help", os.Args[0])
+		}
+	}
+
+	// A local model doesn't need the internet, so only check if we have to
+	needInternet := false
+	for _, p := range opts.selected {
+		if !p.Capabilities().Local {
+			needInternet = true
+		}
+	}
+
+	if needInternet {
+		if connected, err := CheckInternetHTTP(); !connected {
+			return fmt.Errorf("not connected to the internet: %w", err)
+		}
+	}
+
+	// Check we have API keys as required
+	for _, p := range opts.selected {
+		if !HaveAPIKey(p) {
+			return fmt.Errorf("please set environment variable %s to use %s", p.EnvKey(), p.Name())
+		}
+	}
+
+	// Context files from the config go before every prompt
+	if !opts.noContext && len(cfg.Context) > 0 {
+		opts.contextFiles, err = LoadContextFiles(cfg.Context, cfg.ContextDir, cfg.ContextProject)
+		if err != nil {
+			return err
+		}
+		if len(opts.contextFiles) > 0 {
+			Print("Context: " + ContextPaths(opts.contextFiles))
+		}
+	}
+
+	return nil
+}
+
+// request builds the request for p, leaving out the params it doesn't take
+// rather than have it refuse them; we warn about those once per provider
+func (opts *askOptions) request(p Provider, cfg Config, prompt string, sources []PromptSource) Request {
+	supported, ignored := p.Capabilities().Params.Filter(opts.genParams)
+	if !opts.warned[p.Name()] {
+		for _, why := range ignored {
+			fmt.Fprintf(os.Stderr, "%s: %s, ignoring it\n", p.Name(), why)
+		}
+		opts.warned[p.Name()] = true
+	}
+
+	return Request{
+		Prompt:  prompt,
+		Sources: sources,
+		Model:   ResolveModel(p, opts.models, cfg),
+		System:  SystemPromptFor(p, opts.systemPrompt, cfg),
+		Params:  supported,
+		Session: opts.session,
+		Turn:    opts.turn,
+	}
+}
+
+// askAll sends each selected provider its request at the same time,
+// rendering or streaming the answers as they come in. A failing provider
+// only fails its own result, the others carry on
+func (opts *askOptions) askAll(ctx context.Context, reqs []Request) ([]Result, []ModelResponse) {
+	var wg sync.WaitGroup
+	printer := NewStreamPrinter(os.Stdout)
+	results := make([]Result, len(opts.selected))
+	responses := make([]ModelResponse, len(opts.selected))
+
+	for i, p := range opts.selected {
+		results[i].Provider = p
+
+		Print("Hitting " + p.Name() + " API ...")
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := WithProviderTimeout(ctx, p, ResolveTimeout(p, opts.timeouts))
+			defer cancel()
+
+			if opts.stream {
+				responses[i], results[i].Err = StreamProvider(ctx, p, reqs[i], opts.logToJsonl, quietMode, printer)
+				return
+			}
+
+			response, duration, err := CompleteProvider(ctx, p, reqs[i], opts.logToJsonl)
+			if err != nil {
+				results[i].Err = err
+				return
+			}
+			responses[i] = response
+			Render(FmtModelResponse(p.Name(), response, duration, quietMode))
+		}()
+	}
+
+	// Wait here ensures we don't return before goroutines finish
+	wg.Wait()
+
+	// What was spent counts against the budget for the next time, in chat
+	if opts.budget != nil {
+		for i, p := range opts.selected {
+			if results[i].Err == nil {
+				opts.budget.Add(budgetEntry(p, responses[i]))
+			}
+		}
+	}
+
+	return results, responses
+}
+
+// cmdAsk sends the prompt to the selected providers, or to all we have keys
+// for. The prompt is the arguments, the text piped on stdin, or both, in which
+// case the arguments are the instruction and stdin the document
+func cmdAsk(cfg Config, args []string) error {
+	opts := newAskOptions()
+
+	fs, err := newAskFlags(&opts)
+	if err != nil {
+		return err
+	}
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	instruction := strings.Join(positional, " ")
+
+	if err := opts.prepare(cfg); err != nil {
+		return err
+	}
+
+	return opts.askOnce(cfg, instruction, nil)
+}
+
+// askOnce reads the prompt as ask does and sends it to the selected
+// providers, each after its history, if any, keyed by provider name
+func (opts *askOptions) askOnce(cfg Config, instruction string, histories map[string][]Message) error {
+	// --- Read prompt from stdin ---
+	var document string
+
+	// Check if stdin is coming from a pipe or redirection
+	fileInfo, _ := os.Stdin.Stat()
+	isPipe := (fileInfo.Mode() & os.ModeCharDevice) == 0
+
+	// Given an instruction we only read stdin if something's been piped in
+	if isPipe || instruction == "" {
+		if !isPipe {
+			// Interactive mode, display prompt
+			fmt.Print("Prompt (press Ctrl+D when done) > ")
+		}
+		inputBytes, err := io.ReadAll(bufio.NewReader(os.Stdin)) // Read until EOF
+
+		if err != nil {
+			return fmt.Errorf("failed to read input: %w", err)
+		}
+		// impliedly input is good
+
+		document = string(inputBytes)
+	}
+
+	promptText, sources := BuildPrompt(instruction, document)
+	if promptText == "" {
+		return fmt.Errorf("no prompt given")
+	}
+	promptText, sources = AttachContext(promptText, sources, opts.contextFiles)
+
+	// Only now, having read stdin, do we take over Ctrl-C
+	ctx, cancel := InterruptContext(context.Background())
+	defer cancel()
+
+	reqs := make([]Request, len(opts.selected))
+	for i, p := range opts.selected {
+		reqs[i] = opts.request(p, cfg, promptText, sources)
+		reqs[i].History = histories[p.Name()]
+	}
+	if err := opts.checkBudget(reqs); err != nil {
+		return err
+	}
+
+	results, _ := opts.askAll(ctx, reqs)
+
+	PrintFailures(os.Stderr, results)
+
+	if !quietMode {
+		RenderWithGlamour("\n# Done\n")
+	}
+
+	if ExitCode(results, opts.failOn) != 0 {
+		return errProvidersFailed
+	}
+	return nil
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// BudgetLimits caps spending per day and per month, in USD and tokens; 0
+// means no limit
+type BudgetLimits struct {
+	DailyUSD      float64 `toml:"daily_usd,omitempty"`
+	MonthlyUSD    float64 `toml:"monthly_usd,omitempty"`
+	DailyTokens   int     `toml:"daily_tokens,omitempty"`
+	MonthlyTokens int     `toml:"monthly_tokens,omitempty"`
+}
+
+// IsSet is true if any limit is set
+func (limits BudgetLimits) IsSet() bool {
+	return limits != BudgetLimits{}
+}
+
+// Validate checks no limit is negative
+func (limits BudgetLimits) Validate() error {
+	if limits.DailyUSD < 0 || limits.MonthlyUSD < 0 || limits.DailyTokens < 0 || limits.MonthlyTokens < 0 {
+		return fmt.Errorf("budget limits can't be negative")
+	}
+	return nil
+}
+
+// BudgetConfig is the budget section of the config: limits for all the
+// providers together, and for each of them
+type BudgetConfig struct {
+	BudgetLimits
+	// Providers have limits of their own, keyed by provider name
+	Providers map[string]BudgetLimits `toml:"providers"`
+	// Warn only warns when a call would go over budget, rather than refusing
+	Warn bool `toml:"warn,omitempty"`
+}
+
+// IsSet is true if there's a limit on anything
+func (budget BudgetConfig) IsSet() bool {
+	if budget.BudgetLimits.IsSet() {
+		return true
+	}
+	for _, limits := range budget.Providers {
+		if limits.IsSet() {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the limits and that the providers exist
+func (budget BudgetConfig) Validate(cfg Config) error {
+	if err := budget.BudgetLimits.Validate(); err != nil {
+		return err
+	}
+	for name, limits := range budget.Providers {
+		if _, ok := LookupProvider(name); !ok && !cfg.declaresProvider(name) {
+			return fmt.Errorf("unknown provider %q in budget.providers", name)
+		}
+		if err := limits.Validate(); err != nil {
+			return fmt.Errorf("%w, see budget.providers.%s", err, name)
+		}
+	}
+	return nil
+}
+
+// LimitsFor returns the limits of the provider named name
+func (budget BudgetConfig) LimitsFor(name string) BudgetLimits {
+	for key, limits := range budget.Providers {
+		if strings.EqualFold(key, name) {
+			return limits
+		}
+	}
+	return BudgetLimits{}
+}
+
+// Spend is what's been used today and this month
+type Spend struct {
+	DayTokens   int
+	MonthTokens int
+	DayCost     float64
+	MonthCost   float64
+}
+
+// Budget tallies spending this month from the log, and what's spent as we
+// go, to check calls against the budget. Local providers don't count
+type Budget struct {
+	config BudgetConfig
+	prices map[string]ModelPrice
+	// dayStart and monthStart are midnight today and on the 1st, local time
+	dayStart   time.Time
+	monthStart time.Time
+	// spent is keyed by provider name, with the total under ""
+	spent map[string]*Spend
+	// lastModels are the models last used, keyed by provider name, to price
+	// calls which leave the model to the provider
+	lastModels map[string]string
+}
+
+// NewBudget returns a budget with nothing spent, as of now
+func NewBudget(cfg Config, now time.Time) *Budget {
+	year, month, day := now.Date()
+	return &Budget{
+		config:     cfg.Budget,
+		prices:     cfg.PriceTable(),
+		dayStart:   time.Date(year, month, day, 0, 0, 0, 0, now.Location()),
+		monthStart: time.Date(year, month, 1, 0, 0, 0, 0, now.Location()),
+		spent:      map[string]*Spend{"": {}},
+		lastModels: map[string]string{},
+	}
+}
+
+// LoadBudget returns the budget with this month's spending from the log
+func LoadBudget(cfg Config, now time.Time) (*Budget, error) {
+	budget := NewBudget(cfg, now)
+
+	err := ScanLogSince(budget.monthStart, budget.Add)
+	if errors.Is(err, fs.ErrNotExist) {
+		return budget, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return budget, nil
+}
+
+// Add counts the call logged in entry, if it was this month
+func (b *Budget) Add(entry LogEntry) {
+	if entry.Timestamp.Before(b.monthStart) {
+		return
+	}
+	if p, ok := LookupProvider(entry.Provider); ok && p.Capabilities().Local {
+		return
+	}
+	if entry.ModelName != "" {
+		b.lastModels[entry.Provider] = entry.ModelName
+	}
+
+	cost, _ := EntryCost(b.prices, entry)
+	today := !entry.Timestamp.Before(b.dayStart)
+	b.spend("", entry.TotalTokens, cost, today)
+	// Entries from before the provider was logged only count to the total
+	if entry.Provider != "" {
+		b.spend(entry.Provider, entry.TotalTokens, cost, today)
+	}
+}
+
+// spend adds tokens and cost to what's been spent this month, and today if
+// today, by the provider named key, or all of them if key is ""
+func (b *Budget) spend(key string, tokens int, cost float64, today bool) {
+	spend, ok := b.spent[key]
+	if !ok {
+		spend = &Spend{}
+		b.spent[key] = spend
+	}
+
+	spend.MonthTokens += tokens
+	spend.MonthCost += cost
+	if today {
+		spend.DayTokens += tokens
+		spend.DayCost += cost
+	}
+}
+
+// clone returns a copy of b which can be spent separately
+func (b *Budget) clone() *Budget {
+	clone := *b
+	clone.spent = make(map[string]*Spend, len(b.spent))
+	for key, spend := range b.spent {
+		copied := *spend
+		clone.spent[key] = &copied
+	}
+	return &clone
+}
+
+// Spent returns what the provider named name has spent, or all of them if
+// name is ""
+func (b *Budget) Spent(name string) Spend {
+	if spend, ok := b.spent[name]; ok {
+		return *spend
+	}
+	return Spend{}
+}
+
+// estimateTokens guesses the tokens in text at four characters each
+func estimateTokens(text string) int {
+	return len(text)/4 + 1
+}
+
+// Estimate guesses what req would use with p, as a log entry: the prompt,
+// system prompt and history in, and at most max tokens out if set
+func (b *Budget) Estimate(p Provider, req Request) LogEntry {
+	promptTokens := estimateTokens(req.System)
+	for _, message := range req.Conversation() {
+		promptTokens += estimateTokens(message.Content)
+	}
+
+	completionTokens := 0
+	if req.Params.MaxTokens != nil {
+		completionTokens = *req.Params.MaxTokens
+	}
+
+	model := req.Model
+	if model == "" {
+		model = b.lastModels[p.Name()]
+	}
+
+	return LogEntry{
+		Provider:         p.Name(),
+		ModelName:        model,
+		TotalTokens:      promptTokens + completionTokens,
+		PromptTokens:     promptTokens,
+		CompletionTokens: completionTokens,
+		Timestamp:        b.dayStart,
+	}
+}
+
+// Check returns how each call, estimated as log entries, would take the
+// spending over the budget, if it would
+func (b *Budget) Check(estimates []LogEntry) []string {
+	// What the spending would be after the calls
+	after := b.clone()
+	for _, estimate := range estimates {
+		after.Add(estimate)
+	}
+
+	var over []string
+	check := func(who string, limits BudgetLimits, spend Spend, before Spend) {
+		if limits.DailyUSD > 0 && spend.DayCost > limits.DailyUSD {
+			over = append(over, fmt.Sprintf("%s daily budget of $%.2f, with $%.2f spent today and about $%.2f more", who, limits.DailyUSD, before.DayCost, spend.DayCost-before.DayCost))
+		}
+		if limits.MonthlyUSD > 0 && spend.MonthCost > limits.MonthlyUSD {
+			over = append(over, fmt.Sprintf("%s monthly budget of $%.2f, with $%.2f spent this month and about $%.2f more", who, limits.MonthlyUSD, before.MonthCost, spend.MonthCost-before.MonthCost))
+		}
+		if limits.DailyTokens > 0 && spend.DayTokens > limits.DailyTokens {
+			over = append(over, fmt.Sprintf("%s daily budget of %d tokens, with %d used today and about %d more", who, limits.DailyTokens, before.DayTokens, spend.DayTokens-before.DayTokens))
+		}
+		if limits.MonthlyTokens > 0 && spend.MonthTokens > limits.MonthlyTokens {
+			over = append(over, fmt.Sprintf("%s monthly budget of %d tokens, with %d used this month and about %d more", who, limits.MonthlyTokens, before.MonthTokens, spend.MonthTokens-before.MonthTokens))
+		}
+	}
+
+	check("the", b.config.BudgetLimits, after.Spent(""), b.Spent(""))
+	for _, estimate := range estimates {
+		check(estimate.Provider+"'s", b.config.LimitsFor(estimate.Provider), after.Spent(estimate.Provider), b.Spent(estimate.Provider))
+	}
+	return over
+}
+
+// PrintBudget writes a table of each limit, what's been spent against it
+// and what's left
+func PrintBudget(w io.Writer, b *Budget, providers []string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "BUDGET\tPERIOD\tLIMIT\tSPENT\tLEFT")
+
+	row := func(who string, limits BudgetLimits, spend Spend) {
+		money := func(period string, limit float64, spent float64) {
+			if limit > 0 {
+				fmt.Fprintf(tw, "%s\t%s\t$%.2f\t$%.2f\t$%.2f\n", who, period, limit, spent, max(limit-spent, 0))
+			}
+		}
+		tokens := func(period string, limit int, spent int) {
+			if limit > 0 {
+				fmt.Fprintf(tw, "%s\t%s\t%d tokens\t%d\t%d\n", who, period, limit, spent, max(limit-spent, 0))
+			}
+		}
+		money("today", limits.DailyUSD, spend.DayCost)
+		tokens("today", limits.DailyTokens, spend.DayTokens)
+		money("this month", limits.MonthlyUSD, spend.MonthCost)
+		tokens("this month", limits.MonthlyTokens, spend.MonthTokens)
+	}
+
+	row("all", b.config.BudgetLimits, b.Spent(""))
+	for _, name := range providers {
+		row(name, b.config.LimitsFor(name), b.Spent(name))
+	}
+	return tw.Flush()
+}
+
+// budgetEntry is response as a log entry, to add to a budget
+func budgetEntry(p Provider, response ModelResponse) LogEntry {
+	return LogEntry{
+		Provider:         p.Name(),
+		ModelName:        response.Model,
+		TotalTokens:      response.TotalTokens,
+		PromptTokens:     response.PromptTokens,
+		CompletionTokens: response.CompletionTokens,
+		CachedTokens:     response.CachedTokens,
+		ReasoningTokens:  response.ReasoningTokens,
+		Timestamp:        time.Now(),
+	}
+}
+
+// checkBudget refuses to send reqs if they'd take the spending over the
+// budget, unless the budget only warns or --force was given
+func (opts *askOptions) checkBudget(reqs []Request) error {
+	if opts.budget == nil {
+		return nil
+	}
+
+	estimates := make([]LogEntry, len(reqs))
+	for i, p := range opts.selected {
+		estimates[i] = opts.budget.Estimate(p, reqs[i])
+	}
+	over := opts.budget.Check(estimates)
+	if len(over) == 0 {
+		return nil
+	}
+
+	if opts.force || opts.budget.config.Warn {
+		for _, each := range over {
+			fmt.Fprintf(os.Stderr, "Going over %s\n", each)
+		}
+		return nil
+	}
+	return fmt.Errorf("this would go over %s; use --force to send it anyway", strings.Join(over, ", and "))
+}
+
+// cmdBudget shows the budgets and what's left of them
+func cmdBudget(cfg Config, args []string) error {
+	if len(args) > 0 {
+		return fmt.Errorf("usage: %s budget", os.Args[0])
+	}
+	if !cfg.Budget.IsSet() {
+		fmt.Println("No budget is set, see budget in the config")
+		return nil
+	}
+
+	budget, err := LoadBudget(cfg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var providers []string
+	for _, p := range Providers() {
+		if cfg.Budget.LimitsFor(p.Name()).IsSet() {
+			providers = append(providers, p.Name())
+		}
+	}
+	return PrintBudget(os.Stdout, budget, providers)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+func TestBudgetConfig(t *testing.T) {
+	cfg := DefaultConfig()
+	_, err := toml.Decode(`
+[budget]
+daily_usd = 5
+monthly_tokens = 1000000
+
+[budget.providers.chatgpt]
+daily_usd = 1
+`, &cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Budget.DailyUSD != 5 || cfg.Budget.MonthlyTokens != 1000000 || cfg.Budget.LimitsFor("ChatGPT").DailyUSD != 1 {
+		t.Errorf("Unexpected budget %+v", cfg.Budget)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	cfg.Budget.Providers["nonesuch"] = BudgetLimits{DailyUSD: 1}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected an error for an unknown provider")
+	}
+}
+
+func TestBudgetCheck(t *testing.T) {
+	logPath = filepath.Join(t.TempDir(), "gollm_logs.jsonl")
+	t.Cleanup(func() { logPath = "" })
+
+	now := time.Date(2025, 5, 10, 12, 0, 0, 0, time.Local)
+	prices := map[string]ModelPrice{"gpt-test": {Input: 1, Output: 1}}
+	cfg := Config{Prices: prices, Budget: BudgetConfig{
+		BudgetLimits: BudgetLimits{MonthlyTokens: 5000},
+		Providers:    map[string]BudgetLimits{"chatgpt": {DailyUSD: 0.002}},
+	}}
+
+	entries := []LogEntry{
+		// Last month, today, earlier this month and a local model
+		{Provider: "ChatGPT", ModelName: "gpt-test", TotalTokens: 9000, Timestamp: now.AddDate(0, -1, 0)},
+		{Provider: "ChatGPT", ModelName: "gpt-test", TotalTokens: 1500, Timestamp: now.Add(-time.Hour)},
+		{Provider: "Anthropic", ModelName: "claude-test", TotalTokens: 2000, Timestamp: now.AddDate(0, 0, -3)},
+		{Provider: "Ollama", ModelName: "llama3.2", TotalTokens: 9000, Timestamp: now},
+	}
+	for _, entry := range entries {
+		if err := WriteLogEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	budget, err := LoadBudget(cfg, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spent := budget.Spent(""); spent.MonthTokens != 3500 || spent.DayTokens != 1500 {
+		t.Errorf("Expected 3500 tokens this month and 1500 today, got %+v", spent)
+	}
+	if spent := budget.Spent("ChatGPT"); spent.DayCost < 0.00149 || spent.DayCost > 0.00151 {
+		t.Errorf("Expected $0.0015 spent on ChatGPT today, got %+v", spent)
+	}
+
+	// A short prompt fits, but 1000 tokens more takes ChatGPT over $0.002 today
+	small := budget.Estimate(chatGPTProvider{}, Request{Prompt: "Hi"})
+	if over := budget.Check([]LogEntry{small}); len(over) != 0 {
+		t.Errorf("Expected a short prompt to fit, got %q", over)
+	}
+	large := budget.Estimate(chatGPTProvider{}, Request{Prompt: strings.Repeat("word ", 800)})
+	if large.ModelName != "gpt-test" {
+		t.Errorf("Expected the last model used to price the call, got %q", large.ModelName)
+	}
+	over := budget.Check([]LogEntry{large})
+	if len(over) != 1 || !strings.HasPrefix(over[0], "ChatGPT's daily budget of $0.00") {
+		t.Errorf("Expected ChatGPT's daily budget to be over, got %q", over)
+	}
+
+	// Together they're over the monthly tokens too
+	over = budget.Check([]LogEntry{large, budget.Estimate(anthropicProvider{}, Request{Prompt: strings.Repeat("word ", 800)})})
+	if len(over) != 2 || !strings.HasPrefix(over[0], "the monthly budget of 5000 tokens") {
+		t.Errorf("Expected the monthly budget to be over, got %q", over)
+	}
+}
+
+func TestCheckBudgetForce(t *testing.T) {
+	budget := NewBudget(Config{Budget: BudgetConfig{BudgetLimits: BudgetLimits{DailyTokens: 10}}}, time.Now())
+	opts := newAskOptions()
+	opts.selectProvider(chatGPTProvider{})
+	opts.budget = budget
+	reqs := []Request{{Prompt: strings.Repeat("word ", 100)}}
+
+	err := opts.checkBudget(reqs)
+	if err == nil || !strings.Contains(err.Error(), "--force") {
+		t.Errorf("Expected the call to be refused, got %v", err)
+	}
+
+	opts.force = true
+	stderr := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	defer func() { os.Stderr = stderr }()
+	if err := opts.checkBudget(reqs); err != nil {
+		t.Errorf("Expected --force to send it anyway, got %v", err)
+	}
+}
+
+func TestBudgetAddWithoutProvider(t *testing.T) {
+	now := time.Date(2025, 5, 10, 12, 0, 0, 0, time.Local)
+	budget := NewBudget(Config{}, now)
+
+	// Entries from before the provider was logged
+	budget.Add(LogEntry{ModelName: "gpt-4o", TotalTokens: 40, Timestamp: now})
+
+	if spent := budget.Spent(""); spent.DayTokens != 40 || spent.MonthTokens != 40 {
+		t.Errorf("Expected the entry counted once, got %+v", spent)
+	}
+}
+
+func TestBudgetLogsWhenQuiet(t *testing.T) {
+	logPath = filepath.Join(t.TempDir(), "gollm_logs.jsonl")
+	quietMode = true
+	t.Cleanup(func() {
+		logPath = ""
+		quietMode = false
+	})
+
+	stderr := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	defer func() { os.Stderr = stderr }()
+
+	cfg := DefaultConfig()
+	cfg.Budget.DailyUSD = 1
+
+	opts := newAskOptions()
+	opts.selectProvider(ollamaProvider{})
+	opts.logToJsonl = true
+	if err := opts.prepare(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if !opts.logToJsonl || opts.budget == nil {
+		t.Error("Expected calls to be logged against the budget even when quiet")
+	}
+
+	opts = newAskOptions()
+	opts.selectProvider(ollamaProvider{})
+	opts.logToJsonl = true
+	if err := opts.prepare(DefaultConfig()); err != nil {
+		t.Fatal(err)
+	}
+	if opts.logToJsonl {
+		t.Error("Expected no logging when quiet without a budget")
+	}
+}
@@ -2,9 +2,6 @@ package main
 
 import (
 	"context"
-	"fmt"
-	"os"
-	"time"
 
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/option"
@@ -15,6 +12,55 @@ import (
 // For all supported models, we also offer context lengths up to 128K upon request
 const cerebrasDefaultModel = "llama-4-scout-17b-16e-instruct"
 
+const cerebrasApiKey = "CEREBRAS_API_KEY"
+
+const cerebrasBaseURLEnv = "CEREBRAS_BASE_URL"
+
+const cerebrasDefaultBaseURL = "https://api.cerebras.ai/v1"
+
+type cerebrasProvider struct{}
+
+func init() {
+	RegisterProvider(cerebrasProvider{})
+}
+
+func (cerebrasProvider) Name() string   { return "Cerebras" }
+func (cerebrasProvider) Flag() string   { return "f" }
+func (cerebrasProvider) EnvKey() string { return cerebrasApiKey }
+
+func (cerebrasProvider) Capabilities() Capabilities {
+	return Capabilities{Stream: true, Params: allParams}
+}
+
+func (cerebrasProvider) Complete(ctx context.Context, req Request) (ModelResponse, error) {
+	c, err := CerebrasLowerWrapper(ctx, ChatCompletionParams(req, req.ModelOr(cerebrasDefaultModel)), req.Mock)
+	if err != nil {
+		return ModelResponse{}, err
+	}
+	return ModelResponseFromChatCompletion(c), nil
+}
+
+func (cerebrasProvider) Stream(ctx context.Context, req Request, onToken func(string)) (ModelResponse, error) {
+	client, err := cerebrasClient()
+	if err != nil {
+		return ModelResponse{}, err
+	}
+
+	c, err := StreamChatCompletion(ctx, client, ChatCompletionParams(req, req.ModelOr(cerebrasDefaultModel)), onToken)
+	if err != nil {
+		return ModelResponse{}, err
+	}
+	return ModelResponseFromChatCompletion(c), nil
+}
+
+func cerebrasClient() (openai.Client, error) {
+	key, err := RequireAPIKey(cerebrasApiKey)
+	if err != nil {
+		return openai.Client{}, err
+	}
+	return openai.NewClient(option.WithAPIKey(key), option.WithBaseURL(ResolveBaseURL(cerebrasProvider{}.Name(), cerebrasBaseURLEnv, cerebrasDefaultBaseURL)), option.WithMaxRetries(0)), nil
+}
+
 func CerebrasGenChatCompletionMock() *openai.ChatCompletion {
 	return &openai.ChatCompletion{
 		ID:      "cerebras-mock-123",
@@ -39,9 +85,9 @@ func CerebrasGenChatCompletionMock() *openai.ChatCompletion {
 	}
 }
 
-func CerebrasLowerWrapper(promptText string, mock bool) *openai.ChatCompletion {
+func CerebrasLowerWrapper(ctx context.Context, params openai.ChatCompletionNewParams, mock bool) (*openai.ChatCompletion, error) {
 	if mock {
-		return CerebrasGenChatCompletionMock()
+		return CerebrasGenChatCompletionMock(), nil
 	}
 
 	/*
@@ -57,71 +103,10 @@ func CerebrasLowerWrapper(promptText string, mock bool) *openai.ChatCompletion {
 		https://inference-docs.cerebras.ai/resources/openai
 	*/
 
-	client := openai.NewClient(option.WithAPIKey(GetCerebrasAPIKeyOrBail()), option.WithBaseURL("https://api.cerebras.ai/v1"))
-	chatCompletion, err := client.Chat.Completions.New(context.TODO(), openai.ChatCompletionNewParams{
-		Messages: []openai.ChatCompletionMessageParamUnion{
-			openai.UserMessage(promptText),
-		},
-		Model: cerebrasDefaultModel,
-	})
-
+	client, err := cerebrasClient()
 	if err != nil {
-		Fatalf("Some error %s", err)
-	}
-
-	return chatCompletion
-}
-
-func CerebrasMiddleWrapper(promptText string, mock bool) string {
-	fromTime := time.Now()
-
-	c := CerebrasLowerWrapper(promptText, mock)
-
-	duration := time.Since(fromTime)
-
-	// Model: sonar-pro, 135 tokens used, finished due to: length, duration: 0.000 seconds
-	fmtStr := "Model: %s, %d tokens used, finished due to: %s, duration: %.3f seconds"
-
-	status := fmt.Sprintf(fmtStr, c.Model, c.Usage.TotalTokens, c.Choices[0].FinishReason, duration.Seconds())
-
-	// TODO: need to loop through choices per the Gemini example in case we get more than one back
-	return fmt.Sprintf("\n%s\n\n%s", status, c.Choices[0].Message.Content)
-}
-
-// CerebrasWrapper is the top-level function for Cerebras
-func CerebrasWrapper(promptText string, mock bool, logToJsonl bool, quietMode bool) string {
-	fromTime := time.Now()
-
-	c := CerebrasLowerWrapper(promptText, mock)
-
-	duration := time.Since(fromTime)
-
-	// Log successful model call only if logging is enabled
-	if logToJsonl {
-		logEntry := LogEntry{
-			ModelName:     c.Model,
-			TotalTokens:   int(c.Usage.TotalTokens),
-			Duration:      duration.Seconds(),
-			StopReason:    c.Choices[0].FinishReason,
-			PromptText:    promptText,
-			ModelResponse: c.Choices[0].Message.Content,
-			Timestamp:     time.Now(),
-		}
-		if err := WriteLogEntry(logEntry); err != nil {
-			// Log error but don't fail the request
-			fmt.Fprintf(os.Stderr, "Failed to write log entry: %v\n", err)
-		}
-	}
-
-	if quietMode {
-		return c.Choices[0].Message.Content
+		return nil, err
 	}
 
-	// Model: sonar-pro, 135 tokens used, finished due to: length, duration: 0.000 seconds
-	fmtStr := "Model: %s, %d tokens used, finished due to: %s, duration: %.3f seconds"
-
-	status := fmt.Sprintf(fmtStr, c.Model, c.Usage.TotalTokens, c.Choices[0].FinishReason, duration.Seconds())
-
-	// TODO: need to loop through choices per the Gemini example in case we get more than one back
-	return fmt.Sprintf("# Cerebras\n\n%s\n\n%s\n\n", status, c.Choices[0].Message.Content)
+	return client.Chat.Completions.New(ctx, params)
 }
@@ -1,8 +1,15 @@
 package main
 
-import "testing"
+import (
+	"context"
+	"testing"
+)
 
-func TestCerebrasWrapper(t *testing.T) {
+func TestCerebrasProvider(t *testing.T) {
 	quietMode = true
-	Render(CerebrasWrapper("Mock prompt", true, false, quietMode))
+	response, duration, err := CompleteProvider(context.Background(), cerebrasProvider{}, Request{Prompt: "Mock prompt", Mock: true}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Render(FmtModelResponse(cerebrasProvider{}.Name(), response, duration, quietMode))
 }
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// chatPrompt is shown when waiting for the next message
+const chatPrompt = "> "
+
+// chatHelp describes the slash commands
+const chatHelp = `/provider <providers>   talk to these comma separated providers instead, by name or flag
+/model <model>          use this model, or per provider with e.g. gemini=...,chatgpt=...
+/clear                  forget the conversation so far
+/save [file]            save the transcript as markdown
+/help                   show (this) help
+/quit                   leave, as does Ctrl-D`
+
+// chatEntry is one message in the transcript
+type chatEntry struct {
+	// Speaker is "You" or the provider's name
+	Speaker string
+	Model   string
+	Content string
+}
+
+// chatSession is a conversation with one or more providers, each of which
+// has its own history as each sees only its own answers
+type chatSession struct {
+	cfg  Config
+	opts *askOptions
+	// histories are keyed by provider name
+	histories  map[string][]Message
+	transcript []chatEntry
+	// contextSent is true once the context files have gone with a message
+	contextSent bool
+}
+
+func newChatSession(cfg Config, opts *askOptions) *chatSession {
+	return &chatSession{cfg: cfg, opts: opts, histories: map[string][]Message{}}
+}
+
+// send sends prompt to each provider along with its history, and adds it
+// and the answers to the conversation
+func (s *chatSession) send(ctx context.Context, prompt string) []Result {
+	sources := []PromptSource{{Source: SourceArgs, Start: 0, End: len(prompt)}}
+	if !s.contextSent {
+		prompt, sources = AttachContext(prompt, sources, s.opts.contextFiles)
+	}
+
+	reqs := make([]Request, len(s.opts.selected))
+	for i, p := range s.opts.selected {
+		reqs[i] = s.opts.request(p, s.cfg, prompt, sources)
+		reqs[i].History = s.histories[p.Name()]
+	}
+	if err := s.opts.checkBudget(reqs); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return nil
+	}
+
+	results, responses := s.opts.askAll(ctx, reqs)
+	s.opts.turn++
+
+	s.transcript = append(s.transcript, chatEntry{Speaker: "You", Content: prompt})
+	for i, p := range s.opts.selected {
+		// A provider which failed carries on from before, so its history
+		// still alternates
+		if results[i].Err != nil {
+			continue
+		}
+		s.histories[p.Name()] = append(s.histories[p.Name()],
+			Message{Role: "user", Content: prompt},
+			Message{Role: "assistant", Content: responses[i].Content},
+		)
+		// Only once a provider has it, in case the budget stopped the
+		// message or every provider failed
+		s.contextSent = true
+		s.transcript = append(s.transcript, chatEntry{Speaker: p.Name(), Model: responses[i].Model, Content: responses[i].Content})
+	}
+
+	return results
+}
+
+// command runs a slash command, returning true if it's time to leave
+func (s *chatSession) command(line string) (bool, error) {
+	name, arg, _ := strings.Cut(strings.TrimPrefix(line, "/"), " ")
+	arg = strings.TrimSpace(arg)
+
+	switch name {
+	case "quit", "exit":
+		return true, nil
+
+	case "help":
+		fmt.Println(chatHelp)
+
+	case "provider":
+		var selected []Provider
+		for _, each := range splitList(arg) {
+			p, ok := LookupProvider(each)
+			if !ok {
+				if p, ok = FindProviderByFlag(each, ""); !ok {
+					return false, fmt.Errorf("unknown provider %q", each)
+				}
+			}
+			if !HaveAPIKey(p) {
+				return false, fmt.Errorf("please set environment variable %s to use %s", p.EnvKey(), p.Name())
+			}
+			selected = append(selected, p)
+		}
+		if len(selected) == 0 {
+			return false, fmt.Errorf("usage: /provider <providers>")
+		}
+		s.opts.selected = nil
+		for _, p := range selected {
+			s.opts.selectProvider(p)
+			Print("Using " + p.Name())
+		}
+
+	case "model":
+		if arg == "" {
+			return false, fmt.Errorf("usage: /model <model>")
+		}
+		if err := ParseModelFlag(arg, s.opts.models); err != nil {
+			return false, err
+		}
+		for _, p := range s.opts.selected {
+			Print(fmt.Sprintf("%s model: %s", p.Name(), ResolveModel(p, s.opts.models, s.cfg)))
+		}
+
+	case "clear":
+		s.histories = map[string][]Message{}
+		s.contextSent = false
+		// and what follows is a new session in the log
+		s.opts.session = NewSessionID()
+		s.opts.turn = 1
+		Print("Cleared the conversation")
+
+	case "save":
+		path := arg
+		if path == "" {
+			path = fmt.Sprintf("gollm-chat-%s.md", time.Now().Format("20060102-150405"))
+		}
+		if err := os.WriteFile(path, []byte(s.Transcript()), 0644); err != nil {
+			return false, fmt.Errorf("failed to save transcript: %w", err)
+		}
+		Print("Saved the transcript to " + path)
+
+	default:
+		return false, fmt.Errorf("unknown command /%s, try /help", name)
+	}
+
+	return false, nil
+}
+
+// Transcript formats the conversation as markdown
+func (s *chatSession) Transcript() string {
+	var builder strings.Builder
+	for _, entry := range s.transcript {
+		if entry.Model != "" {
+			fmt.Fprintf(&builder, "## %s (%s)\n\n", entry.Speaker, entry.Model)
+		} else {
+			fmt.Fprintf(&builder, "## %s\n\n", entry.Speaker)
+		}
+		fmt.Fprintf(&builder, "%s\n\n", strings.TrimSpace(entry.Content))
+	}
+	return builder.String()
+}
+
+// lineReader reads what the user types, a line at a time
+type lineReader interface {
+	ReadLine() (string, error)
+}
+
+// terminalReader gives line editing and history with the arrow keys. The
+// terminal is only raw while reading, so answers print as normal
+type terminalReader struct {
+	fd       int
+	terminal *term.Terminal
+}
+
+func (r *terminalReader) ReadLine() (string, error) {
+	state, err := term.MakeRaw(r.fd)
+	if err != nil {
+		return "", err
+	}
+	defer term.Restore(r.fd, state)
+
+	// Ctrl-C and Ctrl-D both come back as io.EOF
+	return r.terminal.ReadLine()
+}
+
+// scannerReader reads lines piped in, without a prompt
+type scannerReader struct {
+	scanner *bufio.Scanner
+}
+
+func (r *scannerReader) ReadLine() (string, error) {
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return r.scanner.Text(), nil
+}
+
+// newLineReader reads from the terminal if there is one, otherwise from
+// whatever is piped in
+func newLineReader() lineReader {
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		screen := struct {
+			io.Reader
+			io.Writer
+		}{os.Stdin, os.Stdout}
+		return &terminalReader{fd: fd, terminal: term.NewTerminal(screen, chatPrompt)}
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	return &scannerReader{scanner: scanner}
+}
+
+// cmdChat holds a conversation with the selected providers until the user
+// leaves. It takes the same options as ask, and any prompt given is the
+// first message
+func cmdChat(cfg Config, args []string) error {
+	opts := newAskOptions()
+
+	fs, err := newAskFlags(&opts)
+	if err != nil {
+		return err
+	}
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if err := opts.prepare(cfg); err != nil {
+		return err
+	}
+
+	session := newChatSession(cfg, &opts)
+	reader := newLineReader()
+	Print("Type /help for commands, Ctrl-D to leave")
+
+	line := strings.Join(positional, " ")
+	for {
+		if line = strings.TrimSpace(line); line != "" {
+			if strings.HasPrefix(line, "/") {
+				quit, err := session.command(line)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+				}
+				if quit {
+					return nil
+				}
+			} else {
+				// Ctrl-C cancels this turn rather than the whole chat
+				ctx, cancel := InterruptContext(context.Background())
+				PrintFailures(os.Stderr, session.send(ctx, line))
+				cancel()
+			}
+		}
+
+		line, err = reader.ReadLine()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read input: %w", err)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChatSessionHistory(t *testing.T) {
+	t.Setenv(anthropicApiKey, "test-api-key")
+	quietMode = true
+
+	// Each answer says how many messages it was sent
+	var requests []AnthropicRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request AnthropicRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		requests = append(requests, request)
+
+		fmt.Fprintf(w, `{"model": "claude-test", "content": [{"type": "text", "text": "Answer %d"}], "stop_reason": "end_turn"}`, len(request.Messages))
+	}))
+	defer server.Close()
+
+	t.Setenv(anthropicBaseURLEnv, server.URL)
+
+	opts := newAskOptions()
+	opts.selectProvider(anthropicProvider{})
+	session := newChatSession(Config{}, &opts)
+
+	for _, prompt := range []string{"Hello", "And again"} {
+		for _, result := range session.send(context.Background(), prompt) {
+			if result.Err != nil {
+				t.Fatal(result.Err)
+			}
+		}
+	}
+
+	if len(requests) != 2 || len(requests[1].Messages) != 3 {
+		t.Fatalf("Expected the second request to carry the first exchange, got %+v", requests)
+	}
+	if got := requests[1].Messages[1]; got.Role != "assistant" || got.Content != "Answer 1" {
+		t.Errorf("Expected the first answer in the history, got %+v", got)
+	}
+
+	if _, err := session.command("/clear"); err != nil {
+		t.Fatal(err)
+	}
+	session.send(context.Background(), "Start over")
+	if len(requests[2].Messages) != 1 {
+		t.Errorf("Expected no history after /clear, got %+v", requests[2].Messages)
+	}
+
+	transcript := filepath.Join(t.TempDir(), "chat.md")
+	if _, err := session.command("/save " + transcript); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := os.ReadFile(transcript)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(saved), "## You\n\nAnd again\n\n## Anthropic (claude-test)\n\nAnswer 3") {
+		t.Errorf("Unexpected transcript %s", saved)
+	}
+}
+
+func TestChatContextAfterBudgetRefusal(t *testing.T) {
+	t.Setenv(anthropicApiKey, "test-api-key")
+	quietMode = true
+
+	var requests []AnthropicRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request AnthropicRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		requests = append(requests, request)
+		fmt.Fprint(w, `{"model": "claude-test", "content": [{"type": "text", "text": "Answer"}], "stop_reason": "end_turn"}`)
+	}))
+	defer server.Close()
+
+	t.Setenv(anthropicBaseURLEnv, server.URL)
+
+	opts := newAskOptions()
+	opts.selectProvider(anthropicProvider{})
+	opts.contextFiles = []ContextFile{{Path: "notes.md", Content: "Some notes"}}
+	opts.budget = NewBudget(Config{Budget: BudgetConfig{BudgetLimits: BudgetLimits{DailyTokens: 100}}}, time.Now())
+	session := newChatSession(Config{}, &opts)
+
+	// The first message is over budget, so doesn't go
+	stderr := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	session.send(context.Background(), strings.Repeat("word ", 200))
+	os.Stderr = stderr
+
+	session.send(context.Background(), "Short")
+	if len(requests) != 1 || !strings.Contains(requests[0].Messages[0].Content, "Some notes") {
+		t.Errorf("Expected the context to go with the first message sent, got %+v", requests)
+	}
+}
+
+func TestChatContextAfterFailure(t *testing.T) {
+	t.Setenv(anthropicApiKey, "test-api-key")
+	quietMode = true
+
+	var requests []AnthropicRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request AnthropicRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		requests = append(requests, request)
+		if len(requests) == 1 {
+			http.Error(w, `{"error": {"message": "invalid x-api-key"}}`, http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"model": "claude-test", "content": [{"type": "text", "text": "Answer"}], "stop_reason": "end_turn"}`)
+	}))
+	defer server.Close()
+
+	t.Setenv(anthropicBaseURLEnv, server.URL)
+
+	opts := newAskOptions()
+	opts.selectProvider(anthropicProvider{})
+	opts.contextFiles = []ContextFile{{Path: "notes.md", Content: "Some notes"}}
+	session := newChatSession(Config{}, &opts)
+
+	// Every provider fails the first message, so the context goes again
+	session.send(context.Background(), "First")
+	session.send(context.Background(), "Second")
+	if len(requests) != 2 || !strings.Contains(requests[1].Messages[0].Content, "Some notes") {
+		t.Errorf("Expected the context to go again after a failure, got %+v", requests)
+	}
+
+	// But not once it's been answered
+	session.send(context.Background(), "Third")
+	if len(requests) != 3 || strings.Contains(requests[2].Messages[2].Content, "Some notes") {
+		t.Errorf("Expected the context to go just once, got %+v", requests)
+	}
+}
+
+func TestChatCommands(t *testing.T) {
+	quietMode = true
+	t.Setenv(chatGPTApiKey, "test-api-key")
+
+	opts := newAskOptions()
+	opts.selectProvider(ollamaProvider{})
+	session := newChatSession(Config{}, &opts)
+
+	if _, err := session.command("/provider c"); err != nil || len(opts.selected) != 1 || opts.selected[0].Name() != "ChatGPT" {
+		t.Errorf("Expected to switch to ChatGPT, got %v (%v)", opts.selected, err)
+	}
+	if _, err := session.command("/provider nonesuch"); err == nil {
+		t.Error("Expected an error for an unknown provider")
+	}
+	if _, err := session.command("/model gpt-test"); err != nil || ResolveModel(chatGPTProvider{}, opts.models, Config{}) != "gpt-test" {
+		t.Errorf("Expected the model to change, got %v (%v)", opts.models, err)
+	}
+	if _, err := session.command("/nonesuch"); err == nil {
+		t.Error("Expected an error for an unknown command")
+	}
+	if quit, _ := session.command("/quit"); !quit {
+		t.Error("Expected /quit to leave")
+	}
+}
@@ -3,24 +3,84 @@ package main
 import (
 	"context"
 	"fmt"
-	"os"
 	"sort"
 	"strings"
 	"time"
 
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/option"
+	"github.com/openai/openai-go/packages/param"
 )
 
-func ListOpenAIModels() string {
-	client := openai.NewClient(option.WithAPIKey(GetChatGPTAPIKeyOrBail()))
+const chatGPTApiKey = "OPENAI_API_KEY"
 
-	// context.TODO() is appropriate for simple short-lived API calls
-	// where e.g. no timeout is needed
-	resp, err := client.Models.List(context.TODO())
+const chatGPTDefaultModel = openai.ChatModelGPT4o
+
+// The client reads this itself, but we want it to beat the config
+const chatGPTBaseURLEnv = "OPENAI_BASE_URL"
+
+type chatGPTProvider struct{}
+
+func init() {
+	RegisterProvider(chatGPTProvider{})
+}
+
+func (chatGPTProvider) Name() string   { return "ChatGPT" }
+func (chatGPTProvider) Flag() string   { return "c" }
+func (chatGPTProvider) EnvKey() string { return chatGPTApiKey }
+
+func (chatGPTProvider) Capabilities() Capabilities {
+	return Capabilities{ListModels: true, Stream: true, Params: allParams}
+}
+
+func (chatGPTProvider) ListModels(ctx context.Context) (string, error) {
+	return ListOpenAIModels(ctx)
+}
+
+func (chatGPTProvider) Complete(ctx context.Context, req Request) (ModelResponse, error) {
+	c, err := ChatGPTLowerWrapper(ctx, chatGPTParams(req), req.Mock)
+	if err != nil {
+		return ModelResponse{}, err
+	}
+	return ModelResponseFromChatCompletion(c), nil
+}
+
+func (chatGPTProvider) Stream(ctx context.Context, req Request, onToken func(string)) (ModelResponse, error) {
+	client, err := chatGPTClient()
+	if err != nil {
+		return ModelResponse{}, err
+	}
+
+	c, err := StreamChatCompletion(ctx, client, chatGPTParams(req), onToken)
+	if err != nil {
+		return ModelResponse{}, err
+	}
+	return ModelResponseFromChatCompletion(c), nil
+}
+
+func chatGPTClient() (openai.Client, error) {
+	key, err := RequireAPIKey(chatGPTApiKey)
+	if err != nil {
+		return openai.Client{}, err
+	}
+	// We do our own retrying, see retry.go
+	opts := []option.RequestOption{option.WithAPIKey(key), option.WithMaxRetries(0)}
+	if baseURL := ResolveBaseURL(chatGPTProvider{}.Name(), chatGPTBaseURLEnv, ""); baseURL != "" {
+		opts = append(opts, option.WithBaseURL(baseURL))
+	}
+	return openai.NewClient(opts...), nil
+}
+
+func ListOpenAIModels(ctx context.Context) (string, error) {
+	client, err := chatGPTClient()
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := client.Models.List(ctx)
 
 	if err != nil {
-		Fatalf("Error listing models: %v", err)
+		return "", fmt.Errorf("error listing models: %w", err)
 	}
 
 	// Sort models by creation timestamp (descending)
@@ -43,7 +103,7 @@ func ListOpenAIModels() string {
 			builder.WriteString(fmt.Sprintf("- %s: Created: %s\n", model.ID, createdTime))
 		}
 	}
-	return builder.String()
+	return builder.String(), nil
 }
 
 func ChatGPTGenChatCompletionMock() *openai.ChatCompletion {
@@ -51,7 +111,7 @@ func ChatGPTGenChatCompletionMock() *openai.ChatCompletion {
 		ID:      "chatcmpl-mock-123",
 		Object:  "chat.completion",
 		Created: 1677652288, // Example timestamp
-		Model:   openai.ChatModelGPT4o,
+		Model:   chatGPTDefaultModel,
 		Choices: []openai.ChatCompletionChoice{
 			{
 				Index: 0,
@@ -78,71 +138,107 @@ func ChatGPTGenChatCompletionMock() *openai.ChatCompletion {
 	}
 }
 
-func ChatGPTLowerWrapper(promptText string, mock bool) *openai.ChatCompletion {
+func ChatGPTLowerWrapper(ctx context.Context, params openai.ChatCompletionNewParams, mock bool) (*openai.ChatCompletion, error) {
 	if mock {
-		return ChatGPTGenChatCompletionMock()
+		return ChatGPTGenChatCompletionMock(), nil
 	}
 
-	client := openai.NewClient(option.WithAPIKey(GetChatGPTAPIKeyOrBail()))
-	chatCompletion, err := client.Chat.Completions.New(context.TODO(), openai.ChatCompletionNewParams{
-		Messages: []openai.ChatCompletionMessageParamUnion{
-			openai.UserMessage(promptText),
-		},
-		Model: openai.ChatModelGPT4o,
-	})
-
+	client, err := chatGPTClient()
 	if err != nil {
-		Fatalf("Some error %s", err)
+		return nil, err
 	}
 
-	return chatCompletion
+	return client.Chat.Completions.New(ctx, params)
 }
 
-func ChatGPTMiddleWrapper(promptText string, mock bool) string {
-	fromTime := time.Now()
+// chatGPTParams builds the request for OpenAI itself, which wants
+// max_completion_tokens rather than max_tokens; the reasoning models refuse
+// the latter
+func chatGPTParams(req Request) openai.ChatCompletionNewParams {
+	params := ChatCompletionParams(req, req.ModelOr(chatGPTDefaultModel))
+	if req.Params.MaxTokens != nil {
+		params.MaxTokens = param.Opt[int64]{}
+		params.MaxCompletionTokens = openai.Int(int64(*req.Params.MaxTokens))
+	}
+	return params
+}
 
-	c := ChatGPTLowerWrapper(promptText, mock)
+// ChatCompletionParams builds the request shared by all OpenAI-style providers
+func ChatCompletionParams(req Request, model string) openai.ChatCompletionNewParams {
+	var messages []openai.ChatCompletionMessageParamUnion
+	for _, message := range req.Messages() {
+		switch message.Role {
+		case "system":
+			messages = append(messages, openai.SystemMessage(message.Content))
+		case "assistant":
+			messages = append(messages, openai.AssistantMessage(message.Content))
+		default:
+			messages = append(messages, openai.UserMessage(message.Content))
+		}
+	}
 
-	duration := time.Since(fromTime)
+	params := openai.ChatCompletionNewParams{
+		Messages: messages,
+		Model:    model,
+	}
 
-	// Use the finish reason from the first choice as representative
-	finishReason := "N/A"
-	if len(c.Choices) > 0 {
-		finishReason = string(c.Choices[0].FinishReason) // Convert FinishReason type to string
+	if req.Params.Temperature != nil {
+		params.Temperature = openai.Float(*req.Params.Temperature)
+	}
+	if req.Params.MaxTokens != nil {
+		params.MaxTokens = openai.Int(int64(*req.Params.MaxTokens))
+	}
+	if req.Params.TopP != nil {
+		params.TopP = openai.Float(*req.Params.TopP)
+	}
+	if req.Params.Stop != nil {
+		params.Stop = openai.ChatCompletionNewParamsStopUnion{OfChatCompletionNewsStopArray: req.Params.Stop}
+	}
+	if req.Params.Seed != nil {
+		params.Seed = openai.Int(*req.Params.Seed)
 	}
 
-	var contentBuilder strings.Builder
-	firstFinishReason := finishReason // Store the first reason for comparison
-	for i, choice := range c.Choices {
-		if i > 0 {
-			contentBuilder.WriteString("\n---\n") // Add separator for multiple choices
+	return params
+}
+
+// StreamChatCompletion streams an OpenAI-style chat completion, passing the
+// content of the first choice to onToken as it arrives, and returns the
+// accumulated completion
+func StreamChatCompletion(ctx context.Context, client openai.Client, params openai.ChatCompletionNewParams, onToken func(string)) (*openai.ChatCompletion, error) {
+	// Without this there is no usage in a streamed response
+	params.StreamOptions = openai.ChatCompletionStreamOptionsParam{IncludeUsage: openai.Bool(true)}
+
+	stream := client.Chat.Completions.NewStreaming(ctx, params)
+	defer stream.Close()
+
+	acc := openai.ChatCompletionAccumulator{}
+	for stream.Next() {
+		chunk := stream.Current()
+		acc.AddChunk(chunk)
+		// The accumulator adds up the counts but not their details, which
+		// come in the last chunk with the usage
+		if chunk.Usage.TotalTokens > 0 {
+			acc.Usage.PromptTokensDetails = chunk.Usage.PromptTokensDetails
+			acc.Usage.CompletionTokensDetails = chunk.Usage.CompletionTokensDetails
 		}
-		contentBuilder.WriteString(choice.Message.Content)
 
-		// Check if finish reason is different from the first one
-		currentFinishReason := string(choice.FinishReason)
-		if currentFinishReason != firstFinishReason {
-			// Append if different and not already added (to avoid duplicates if many differ)
-			if !strings.Contains(finishReason, currentFinishReason) {
-				finishReason += ", " + currentFinishReason
+		for _, choice := range chunk.Choices {
+			if choice.Index == 0 && choice.Delta.Content != "" {
+				onToken(choice.Delta.Content)
 			}
 		}
 	}
 
-	// Update status string *after* the loop in case finishReason was modified
-	fmtStr := "Model: %s, %d tokens used, finished due to: %s, duration: %.3f seconds"
-	status := fmt.Sprintf(fmtStr, c.Model, c.Usage.TotalTokens, finishReason, duration.Seconds())
+	if err := stream.Err(); err != nil {
+		return nil, err
+	}
 
-	return fmt.Sprintf("\n%s\n\n%s", status, contentBuilder.String())
+	return &acc.ChatCompletion, nil
 }
 
-func ChatGPTWrapper(promptText string, mock bool, logToJsonl bool, quietMode bool) string {
-	fromTime := time.Now()
-
-	c := ChatGPTLowerWrapper(promptText, mock)
-
-	duration := time.Since(fromTime)
-
+// ModelResponseFromChatCompletion flattens an OpenAI-style chat completion,
+// joining multiple choices and their finish reasons
+func ModelResponseFromChatCompletion(c *openai.ChatCompletion) ModelResponse {
 	// Use the finish reason from the first choice as representative
 	finishReason := "N/A"
 	if len(c.Choices) > 0 {
@@ -167,30 +263,14 @@ func ChatGPTWrapper(promptText string, mock bool, logToJsonl bool, quietMode boo
 		}
 	}
 
-	// Log successful model call only if logging is enabled
-	if logToJsonl {
-		logEntry := LogEntry{
-			ModelName:     c.Model,
-			TotalTokens:   int(c.Usage.TotalTokens),
-			Duration:      duration.Seconds(),
-			StopReason:    finishReason,
-			PromptText:    promptText,
-			ModelResponse: contentBuilder.String(),
-			Timestamp:     time.Now(),
-		}
-		if err := WriteLogEntry(logEntry); err != nil {
-			// Log error but don't fail the request
-			fmt.Fprintf(os.Stderr, "Failed to write log entry: %v\n", err)
-		}
-	}
-
-	if quietMode {
-		return contentBuilder.String()
+	return ModelResponse{
+		Model:            c.Model,
+		TotalTokens:      int(c.Usage.TotalTokens),
+		PromptTokens:     int(c.Usage.PromptTokens),
+		CompletionTokens: int(c.Usage.CompletionTokens),
+		CachedTokens:     int(c.Usage.PromptTokensDetails.CachedTokens),
+		ReasoningTokens:  int(c.Usage.CompletionTokensDetails.ReasoningTokens),
+		Content:          contentBuilder.String(),
+		FinishReason:     finishReason,
 	}
-
-	// Update status string *after* the loop in case finishReason was modified
-	fmtStr := "Model: %s, %d tokens used, finished due to: %s, duration: %.3f seconds"
-	status := fmt.Sprintf(fmtStr, c.Model, c.Usage.TotalTokens, finishReason, duration.Seconds())
-
-	return fmt.Sprintf("# ChatGPT\n\n%s\n\n%s\n\n", status, contentBuilder.String())
 }
@@ -1,8 +1,15 @@
 package main
 
-import "testing"
+import (
+	"context"
+	"testing"
+)
 
-func TestChatGPTWrapper(t *testing.T) {
+func TestChatGPTProvider(t *testing.T) {
 	quietMode = true
-	Render(ChatGPTWrapper("Mock prompt", true, false, quietMode))
+	response, duration, err := CompleteProvider(context.Background(), chatGPTProvider{}, Request{Prompt: "Mock prompt", Mock: true}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Render(FmtModelResponse(chatGPTProvider{}.Name(), response, duration, quietMode))
 }
@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Command is one of gollm's subcommands, e.g. gollm log list
+type Command struct {
+	Name string
+	// Args describes the arguments, for the usage
+	Args    string
+	Summary string
+	Run     func(cfg Config, args []string) error
+}
+
+// Commands returns gollm's subcommands in the order they're shown in the usage
+func Commands() []Command {
+	return []Command{
+		{"ask", "[options] [prompt]", "send the prompt, and anything piped in, to the providers (the default)", cmdAsk},
+		{"chat", "[options] [prompt]", "hold a conversation with the providers, see /help once in", cmdChat},
+		{"resume", "<session> [options] [prompt]", "send a follow up to a session from the log, by ID or --entry", cmdResume},
+		{"models", "<provider>", "list a provider's models", cmdModels},
+		{"keys", "", "test API keys (note: they will be displayed)", cmdKeys},
+		{"budget", "", "show the budgets in the config and what's left of them", cmdBudget},
+		{"log", "list [filters] | show <id> | stats [filters] | verify [--repair]", "show the log index, the response of a log entry, or usage and cost, or check the log for corrupt lines", cmdLog},
+		{"config", "show | get <key> | set [--project] <key> <value>", "show the config files and settings, or get or set one", cmdConfig},
+		{"help", "", "show (this) help", cmdHelp},
+	}
+}
+
+// Fits is true if args, those after the command's name, are the sort it
+// takes as described by Args: anything if it takes a prompt, otherwise one
+// of its verbs, e.g. list or show, or as many as its <arguments>
+func (c Command) Fits(args []string) bool {
+	if len(args) == 0 || strings.Contains(c.Args, "[prompt]") {
+		return true
+	}
+
+	for _, form := range strings.Split(c.Args, "|") {
+		words := strings.Fields(form)
+		if len(words) == 0 {
+			continue
+		}
+		if !strings.HasPrefix(words[0], "<") {
+			if args[0] == words[0] {
+				return true
+			}
+			continue
+		}
+		if len(words) == len(args) {
+			return true
+		}
+	}
+	return false
+}
+
+// LookupCommand finds a subcommand by name
+func LookupCommand(name string) (Command, bool) {
+	for _, c := range Commands() {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return Command{}, false
+}
+
+// Run runs the command line args, less the program name
+func Run(cfg Config, args []string) error {
+	args = LegacyArgs(args)
+
+	c, _ := LookupCommand(args[0])
+	err := c.Run(cfg, args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return cmdHelp(cfg, nil)
+	}
+	return err
+}
+
+// LegacyArgs translates the single dash options gollm used to have into
+// subcommands, so existing scripts keep working:
+//
+//	-h          help
+//	-t          keys
+//	-rl         log list
+//	-rl 3f2a    log show 3f2a
+//	-rl 3f2a --continue [options] [prompt]
+//	            resume --entry 3f2a [options] [prompt]
+//	-lg         models gemini
+//	-l -q -c    ask -l -q -c
+//
+// Args which already start with a subcommand are returned as they are, as
+// long as the rest fits it, so a prompt such as help me write a regex is
+// still asked. A prompt after -- is always asked
+func LegacyArgs(args []string) []string {
+	if len(args) == 0 {
+		return []string{"ask"}
+	}
+	if c, ok := LookupCommand(args[0]); ok && c.Fits(args[1:]) {
+		return args
+	}
+
+	for idx, each := range args {
+		switch each {
+		case "--":
+			// Everything after is the prompt
+			return append([]string{"ask"}, args...)
+		case "-h", "-help", "--help":
+			return []string{"help"}
+		case "-t":
+			return []string{"keys"}
+		case "-rl":
+			// An ID after -rl means show that entry, or with --continue
+			// send a follow up to its session
+			if idx+1 < len(args) && !strings.HasPrefix(args[idx+1], "-") {
+				rest := append(append([]string{}, args[:idx]...), args[idx+2:]...)
+				if i := slices.Index(rest, "--continue"); i >= 0 {
+					rest = slices.Delete(rest, i, i+1)
+					return append([]string{"resume", "--entry", args[idx+1]}, rest...)
+				}
+				return []string{"log", "show", args[idx+1]}
+			}
+			return []string{"log", "list"}
+		}
+
+		if p, ok := FindProviderByFlag(each, "-l"); ok && p.Capabilities().ListModels {
+			return []string{"models", p.Name()}
+		}
+	}
+
+	return append([]string{"ask"}, args...)
+}
+
+func cmdModels(cfg Config, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s models <provider>", os.Args[0])
+	}
+
+	p, ok := LookupProvider(args[0])
+	if !ok {
+		// Allow the flag too, e.g. models g
+		if p, ok = FindProviderByFlag(args[0], ""); !ok {
+			return fmt.Errorf("unknown provider %q", args[0])
+		}
+	}
+
+	lister, ok := p.(ModelLister)
+	if !ok {
+		return fmt.Errorf("%s can't list its models", p.Name())
+	}
+
+	ctx, cancel := WithProviderTimeout(context.Background(), p, defaultTimeout)
+	defer cancel()
+
+	models, err := lister.ListModels(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing %s models: %w", p.Name(), err)
+	}
+	fmt.Println(models)
+	return nil
+}
+
+func cmdKeys(cfg Config, args []string) error {
+	PrintAPIKeys()
+	return nil
+}
+
+func cmdLog(cfg Config, args []string) error {
+	if len(args) == 0 || args[0] == "list" {
+		if len(args) > 0 {
+			args = args[1:]
+		}
+		return cmdLogList(args)
+	}
+
+	if args[0] == "show" && len(args) == 2 {
+		return ShowLog(args[1])
+	}
+	if args[0] == "stats" {
+		return cmdLogStats(cfg, args[1:])
+	}
+	if args[0] == "verify" {
+		return cmdLogVerify(args[1:])
+	}
+
+	return fmt.Errorf("usage: %s log list [filters] | show <id> | stats [filters] | verify [--repair]", os.Args[0])
+}
+
+// logListOptions are the flags of log list
+type logListOptions struct {
+	filter LogFilter
+	limit  int
+	page   int
+}
+
+// newLogListFlags returns the flags of log list, which fill in opts, with
+// times such as 7d taken back from now
+func newLogListFlags(opts *logListOptions, now time.Time) *flag.FlagSet {
+	fs := flag.NewFlagSet("log list", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	addLogFilterFlags(fs, &opts.filter, now)
+	fs.IntVar(&opts.limit, "limit", 0, "list at most `n` entries")
+	fs.IntVar(&opts.page, "page", 1, fmt.Sprintf("list page `n`, of --limit entries or %d", defaultPageSize))
+
+	return fs
+}
+
+// addLogFilterFlags adds the flags which fill in filter, shared by log list
+// and log stats
+func addLogFilterFlags(fs *flag.FlagSet, filter *LogFilter, now time.Time) {
+	fs.StringVar(&filter.Model, "model", "", "only entries whose model name contains this `text`")
+	fs.Func("since", "only entries from this `time` on, e.g. 2025-05-01, 2025-05-01 14:30, 36h or 7d ago", func(value string) (err error) {
+		filter.Since, err = ParseLogTime(value, now, false)
+		return err
+	})
+	fs.Func("until", "only entries from before this `time`, a date taking in all of that day", func(value string) (err error) {
+		filter.Until, err = ParseLogTime(value, now, true)
+		return err
+	})
+	fs.Func("grep", "only entries whose prompt or response matches this `regexp`", func(value string) (err error) {
+		filter.Grep, err = regexp.Compile(value)
+		return err
+	})
+	fs.IntVar(&filter.MinTokens, "min-tokens", 0, "only entries which used at least `n` tokens")
+	fs.StringVar(&filter.StopReason, "stop-reason", "", "only entries which stopped for this `reason`, e.g. max_tokens or cancelled")
+}
+
+// cmdLogList lists the entries of the log which pass the filters, a page
+// at a time with --limit and --page
+func cmdLogList(args []string) error {
+	var opts logListOptions
+	positional, err := parseInterspersed(newLogListFlags(&opts, time.Now()), args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("unexpected %q, see %s help", positional[0], os.Args[0])
+	}
+	if opts.limit < 0 || opts.page < 1 {
+		return fmt.Errorf("--limit and --page should be positive")
+	}
+	if opts.page > 1 && opts.limit == 0 {
+		opts.limit = defaultPageSize
+	}
+
+	return ListLog(opts.filter, opts.limit, opts.page)
+}
+
+func cmdConfig(cfg Config, args []string) error {
+	usage := fmt.Errorf("usage: %s config show | get <key> | set [--project] <key> <value>", os.Args[0])
+
+	if len(args) == 0 || args[0] == "show" {
+		configPaths, err := ConfigFiles()
+		if err != nil {
+			return err
+		}
+		for _, configPath := range configPaths {
+			if _, err := os.Stat(configPath); err == nil {
+				fmt.Printf("# %s\n", configPath)
+			} else {
+				fmt.Printf("# %s (not found)\n", configPath)
+			}
+		}
+		fmt.Println()
+		return toml.NewEncoder(os.Stdout).Encode(cfg)
+	}
+
+	switch args[0] {
+	case "get":
+		if len(args) != 2 {
+			return usage
+		}
+		value, err := ConfigGet(cfg, args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Println(value)
+		return nil
+
+	case "set":
+		fs := flag.NewFlagSet("config set", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		project := fs.Bool("project", false, "set it in .gollm.toml in the current directory")
+		rest, err := parseInterspersed(fs, args[1:])
+		if err != nil {
+			return err
+		}
+		if len(rest) != 2 {
+			return usage
+		}
+
+		configPath, err := getConfigPath()
+		if *project {
+			if key, _, _ := strings.Cut(rest[0], "."); userOnlySettings[key] != nil {
+				return fmt.Errorf("%s can only be set in your own config, not a project's", key)
+			}
+			configPath, err = getProjectConfigPath()
+		}
+		if err != nil {
+			return err
+		}
+		if err := ConfigSet(configPath, rest[0], rest[1]); err != nil {
+			return err
+		}
+		Print(fmt.Sprintf("Set %s in %s", rest[0], configPath))
+		return nil
+	}
+
+	return usage
+}
+
+func cmdHelp(cfg Config, args []string) error {
+	connected, _ := CheckInternetHTTP()
+	PrintUsage(connected)
+	return nil
+}
+
+// usageFlags formats the options of fs, skipping provider flags, in the
+// style of the rest of the usage. Short flags which are the same as a long
+// one, e.g. -l and --log, are shown together
+func usageFlags(fs *flag.FlagSet) string {
+	shorts := map[string]string{}
+	fs.VisitAll(func(f *flag.Flag) {
+		if len(f.Name) == 1 && !isProviderFlag(f) {
+			shorts[f.Usage] = f.Name
+		}
+	})
+
+	var builder strings.Builder
+	fs.VisitAll(func(f *flag.Flag) {
+		if isProviderFlag(f) {
+			return
+		}
+
+		name, usage := flag.UnquoteUsage(f)
+		if name != "" {
+			name = " [" + name + "]"
+		}
+
+		switch short, ok := shorts[f.Usage]; {
+		case len(f.Name) == 1:
+			return
+		case ok:
+			fmt.Fprintf(&builder, "\t-%s, --%s%s\t%s\n", short, f.Name, name, usage)
+		default:
+			fmt.Fprintf(&builder, "\t--%s%s\t%s\n", f.Name, name, usage)
+		}
+	})
+	return builder.String()
+}
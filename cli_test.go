@@ -0,0 +1,87 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestLegacyArgs(t *testing.T) {
+	cases := []struct {
+		args []string
+		want []string
+	}{
+		{nil, []string{"ask"}},
+		{[]string{"-h"}, []string{"help"}},
+		{[]string{"-t"}, []string{"keys"}},
+		{[]string{"-rl"}, []string{"log", "list"}},
+		{[]string{"-rl", "3f2a"}, []string{"log", "show", "3f2a"}},
+		{[]string{"-rl", "3f2a", "--continue", "-c", "And then?"}, []string{"resume", "--entry", "3f2a", "-c", "And then?"}},
+		{[]string{"-lg"}, []string{"models", "Gemini"}},
+		{[]string{"-l", "-c", "-g"}, []string{"ask", "-l", "-c", "-g"}},
+		{[]string{"log", "show", "1"}, []string{"log", "show", "1"}},
+		// IDs can be all digits
+		{[]string{"-rl", "20481137"}, []string{"log", "show", "20481137"}},
+		{[]string{"-rl", "20481137", "--continue", "Go on"}, []string{"resume", "--entry", "20481137", "Go on"}},
+		{[]string{"models", "gemini"}, []string{"models", "gemini"}},
+		{[]string{"config", "get", "log_path"}, []string{"config", "get", "log_path"}},
+		{[]string{"chat", "--provider", "gemini"}, []string{"chat", "--provider", "gemini"}},
+		// Prompts which start with the name of a subcommand are asked
+		{[]string{"help", "me", "write", "a", "regex"}, []string{"ask", "help", "me", "write", "a", "regex"}},
+		{[]string{"log", "in", "to", "what?"}, []string{"ask", "log", "in", "to", "what?"}},
+		{[]string{"models", "are", "cheap"}, []string{"ask", "models", "are", "cheap"}},
+		{[]string{"-c", "--", "keys", "-t"}, []string{"ask", "-c", "--", "keys", "-t"}},
+	}
+	for _, c := range cases {
+		if got := LegacyArgs(c.args); !slices.Equal(got, c.want) {
+			t.Errorf("LegacyArgs(%q) = %q, want %q", c.args, got, c.want)
+		}
+	}
+}
+
+func TestAskFlagsCompose(t *testing.T) {
+	opts := askOptions{models: map[string]string{}, timeouts: map[string]time.Duration{}}
+	fs, err := newAskFlags(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// -l used to also match -lg and -rl, and only the first provider was used
+	err = fs.Parse([]string{"-c", "-l", "--model", "gemini=models/gemini-2.5-flash", "-g", "--provider", "perplexity,chatgpt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, p := range opts.selected {
+		names = append(names, p.Name())
+	}
+	if !slices.Equal(names, []string{"ChatGPT", "Gemini", "Perplexity"}) {
+		t.Errorf("Expected ChatGPT, Gemini and Perplexity, got %q", names)
+	}
+	if !opts.logToJsonl {
+		t.Error("Expected logging to be on")
+	}
+	if opts.models["gemini"] != "models/gemini-2.5-flash" {
+		t.Errorf("Unexpected models %v", opts.models)
+	}
+}
+
+func TestParseInterspersed(t *testing.T) {
+	opts := askOptions{models: map[string]string{}, timeouts: map[string]time.Duration{}}
+	fs, err := newAskFlags(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	positional, err := parseInterspersed(fs, []string{"Summarize", "this", "-g", "text", "--", "-c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(positional, []string{"Summarize", "this", "text", "-c"}) {
+		t.Errorf("Unexpected positional arguments %q", positional)
+	}
+	if len(opts.selected) != 1 || opts.selected[0].Name() != "Gemini" {
+		t.Errorf("Expected just Gemini selected, got %v", opts.selected)
+	}
+}
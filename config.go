@@ -0,0 +1,430 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// GOLLM_CONFIG overrides where we look for the config file
+const configPathEnv = "GOLLM_CONFIG"
+
+// projectConfigFile is the per-project config, which takes precedence over
+// the user's config. Like .git it's found by walking up from the current
+// directory
+const projectConfigFile = ".gollm.toml"
+
+// Config is the user's configuration, read from ~/.config/gollm/config.toml
+// and then the project's .gollm.toml. Settings are taken from, in order of
+// precedence, flags, the environment, the project file and the user file
+type Config struct {
+	// DefaultProviders are asked when none are selected, rather than every
+	// provider we have a key for
+	DefaultProviders []string         `toml:"default_providers"`
+	Providers        []ProviderConfig `toml:"providers"`
+	// Models sets default models keyed by provider name, e.g. gemini = "models/gemini-2.5-flash"
+	Models map[string]string `toml:"models"`
+	Params GenerationParams  `toml:"params"`
+	// SystemPrompt is sent to every provider, bar Perplexity if its own
+	// system_prompt is set
+	SystemPrompt string `toml:"system_prompt"`
+	// Personas are named system prompts, chosen with --persona
+	Personas map[string]string `toml:"personas"`
+	LogPath  string            `toml:"log_path"`
+	// Log is how the log is rotated and kept, see LogConfig
+	Log LogConfig `toml:"log"`
+	// RenderStyle is a glamour style such as dark, light or notty, or the
+	// path of a JSON style; the default is auto
+	RenderStyle string `toml:"render_style"`
+	// BaseURLs override where providers are found, keyed by provider name
+	BaseURLs map[string]string `toml:"base_urls"`
+	// Prices override and add to the USD prices per million tokens used to
+	// estimate costs, keyed by model name or the start of one
+	Prices map[string]ModelPrice `toml:"prices"`
+	// Budget limits spending, see BudgetConfig
+	Budget BudgetConfig `toml:"budget"`
+	// Perplexity holds Perplexity's search options
+	Perplexity PerplexityOptions `toml:"perplexity"`
+	// Context lists files or globs, e.g. docs/*.md, whose contents are put
+	// before every prompt. They're relative to ContextDir, the directory of
+	// the file which set them. A project's can only be files inside it
+	Context        []string `toml:"context"`
+	ContextDir     string   `toml:"-"`
+	ContextProject bool     `toml:"-"`
+}
+
+// ProviderConfig declares an extra OpenAI-compatible provider, e.g.
+//
+//	[[providers]]
+//	name = "Groq"
+//	flag = "gr"
+//	base_url = "https://api.groq.com/openai/v1"
+//	key_env = "GROQ_API_KEY"
+//	model = "llama-3.3-70b-versatile"
+type ProviderConfig struct {
+	Name    string `toml:"name"`
+	Flag    string `toml:"flag"`
+	BaseURL string `toml:"base_url"`
+	// KeyEnv can be left empty for servers which don't need a key
+	KeyEnv string `toml:"key_env"`
+	Model  string `toml:"model"`
+	// Local servers (vLLM, llama.cpp etc) don't need the internet and are
+	// only used when selected
+	Local bool `toml:"local"`
+}
+
+// configEnv maps environment variables onto the settings they override
+var configEnv = []struct {
+	key string
+	set func(cfg *Config, value string) error
+}{
+	{"GOLLM_PROVIDERS", func(cfg *Config, value string) error {
+		cfg.DefaultProviders = splitList(value)
+		return nil
+	}},
+	{"GOLLM_SYSTEM_PROMPT", func(cfg *Config, value string) error {
+		cfg.SystemPrompt = value
+		cfg.Perplexity.SystemPrompt = value
+		return nil
+	}},
+	{"GOLLM_LOG_PATH", func(cfg *Config, value string) error {
+		cfg.LogPath = value
+		return nil
+	}},
+	{"GOLLM_RENDER_STYLE", func(cfg *Config, value string) error {
+		cfg.RenderStyle = value
+		return nil
+	}},
+	{"GOLLM_TEMPERATURE", func(cfg *Config, value string) error {
+		return parseFloatParam(value, &cfg.Params.Temperature)
+	}},
+	{"GOLLM_MAX_TOKENS", func(cfg *Config, value string) error {
+		return parseIntParam(value, &cfg.Params.MaxTokens)
+	}},
+	{"GOLLM_TOP_P", func(cfg *Config, value string) error {
+		return parseFloatParam(value, &cfg.Params.TopP)
+	}},
+	{"GOLLM_SEED", func(cfg *Config, value string) error {
+		return parseSeedParam(value, &cfg.Params.Seed)
+	}},
+}
+
+func getConfigPath() (string, error) {
+	if configPath := os.Getenv(configPathEnv); configPath != "" {
+		return configPath, nil
+	}
+
+	// We deliberately use ~/.config everywhere rather than os.UserConfigDir(),
+	// which would be ~/Library/Application Support on a Mac
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get user home directory: %w", err)
+		}
+		configDir = filepath.Join(homeDir, ".config")
+	}
+
+	return filepath.Join(configDir, "gollm", "config.toml"), nil
+}
+
+// getProjectConfigPath returns the nearest project config in the current
+// directory or above it, or where it would be in the current directory if
+// there isn't one
+func getProjectConfigPath() (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current directory: %w", err)
+	}
+	if projectPath, ok := findProjectConfig(cwd); ok {
+		return projectPath, nil
+	}
+	return filepath.Join(cwd, projectConfigFile), nil
+}
+
+// findProjectConfig walks up from dir looking for a project config
+func findProjectConfig(dir string) (string, bool) {
+	for {
+		projectPath := filepath.Join(dir, projectConfigFile)
+		if info, err := os.Stat(projectPath); err == nil && !info.IsDir() {
+			return projectPath, true
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// ConfigFiles returns the config files we read, in the order we read them
+func ConfigFiles() ([]string, error) {
+	userPath, err := getConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	projectPath, err := getProjectConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	return []string{userPath, projectPath}, nil
+}
+
+// DefaultConfig is the config before any files are read
+func DefaultConfig() Config {
+	return Config{Log: LogConfig{Compress: true}, Perplexity: DefaultPerplexityOptions()}
+}
+
+// LoadConfig reads the config files, later ones overriding earlier ones, and
+// then the environment; missing files are not an error
+func LoadConfig() (Config, error) {
+	// Anything not set keeps its default
+	cfg := DefaultConfig()
+
+	configPaths, err := ConfigFiles()
+	if err != nil {
+		return cfg, err
+	}
+
+	for i, configPath := range configPaths {
+		// Only the first, the user's, is trusted with every setting
+		if err := decodeConfigFile(configPath, &cfg, i > 0); err != nil {
+			return cfg, err
+		}
+	}
+
+	for _, each := range configEnv {
+		if value := os.Getenv(each.key); value != "" {
+			if err := each.set(&cfg, value); err != nil {
+				return cfg, fmt.Errorf("bad %s: %w", each.key, err)
+			}
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+// userOnlySettings can only be set in the user's config. A project's config
+// comes with whatever repo was cloned, which could otherwise send the API
+// keys, or the log, somewhere of its choosing, expire the log or lift the
+// budget. Each puts the setting back as it was before the project's config
+// was read
+var userOnlySettings = map[string]func(cfg *Config, before Config){
+	"base_urls": func(cfg *Config, before Config) { cfg.BaseURLs = before.BaseURLs },
+	"log_path":  func(cfg *Config, before Config) { cfg.LogPath = before.LogPath },
+	// A provider's key_env could name another provider's key
+	"providers": func(cfg *Config, before Config) { cfg.Providers = before.Providers },
+	"log":       func(cfg *Config, before Config) { cfg.Log = before.Log },
+	"budget":    func(cfg *Config, before Config) { cfg.Budget = before.Budget },
+}
+
+// decodeConfigFile reads configPath over the top of cfg. A project's config
+// is ignored, with a warning, where it sets any of the userOnlySettings
+func decodeConfigFile(configPath string, cfg *Config, project bool) error {
+	// The decoder adds to maps rather than replacing them
+	before := *cfg
+	before.BaseURLs = maps.Clone(cfg.BaseURLs)
+	before.Budget.Providers = maps.Clone(cfg.Budget.Providers)
+
+	// Providers declared in different files add up rather than replace; the
+	// decoder would otherwise reuse the slice and overwrite them
+	providers := cfg.Providers
+	cfg.Providers = nil
+
+	md, err := toml.DecodeFile(configPath, cfg)
+	if errors.Is(err, fs.ErrNotExist) {
+		cfg.Providers = providers
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config %s: %w", configPath, err)
+	}
+
+	cfg.Providers = append(providers, cfg.Providers...)
+
+	if project {
+		for _, key := range slices.Sorted(maps.Keys(userOnlySettings)) {
+			if md.IsDefined(key) {
+				userOnlySettings[key](cfg, before)
+				fmt.Fprintf(os.Stderr, "Ignoring %s in %s: only your own config can set it\n", key, configPath)
+			}
+		}
+	}
+
+	if md.IsDefined("context") {
+		cfg.ContextDir = filepath.Dir(configPath)
+		cfg.ContextProject = project
+	}
+
+	// The general system prompt is Perplexity's too, unless it has its own
+	if md.IsDefined("system_prompt") && !md.IsDefined("perplexity", "system_prompt") {
+		cfg.Perplexity.SystemPrompt = cfg.SystemPrompt
+	}
+
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		fmt.Fprintf(os.Stderr, "Ignoring unknown settings in %s: %v\n", configPath, undecoded)
+	}
+
+	return nil
+}
+
+// Validate checks settings which would otherwise fail later, or quietly
+func (cfg Config) Validate() error {
+	for _, name := range cfg.DefaultProviders {
+		if _, ok := LookupProvider(name); !ok && !cfg.declaresProvider(name) {
+			return fmt.Errorf("unknown provider %q in default_providers", name)
+		}
+	}
+
+	if err := cfg.Params.Validate(); err != nil {
+		return err
+	}
+	if err := cfg.Budget.Validate(cfg); err != nil {
+		return err
+	}
+	if err := cfg.Log.Validate(); err != nil {
+		return err
+	}
+
+	return cfg.Perplexity.Validate()
+}
+
+// declaresProvider is true if name is one of the providers in the config,
+// which won't be registered yet when we validate
+func (cfg Config) declaresProvider(name string) bool {
+	for _, p := range cfg.Providers {
+		if strings.EqualFold(p.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// baseURLs is set by main from the config
+var baseURLs map[string]string
+
+// ResolveBaseURL returns where to find the provider called name: envKey if
+// it's set, then base_urls in the config, then def
+func ResolveBaseURL(name string, envKey string, def string) string {
+	if envKey != "" {
+		if baseURL := os.Getenv(envKey); baseURL != "" {
+			return strings.TrimSuffix(baseURL, "/")
+		}
+	}
+	for key, baseURL := range baseURLs {
+		if strings.EqualFold(key, name) && baseURL != "" {
+			return strings.TrimSuffix(baseURL, "/")
+		}
+	}
+	return def
+}
+
+// configTree turns cfg into nested maps keyed by the TOML names
+func configTree(cfg Config) (map[string]any, error) {
+	var builder strings.Builder
+	if err := toml.NewEncoder(&builder).Encode(cfg); err != nil {
+		return nil, err
+	}
+
+	tree := map[string]any{}
+	if _, err := toml.Decode(builder.String(), &tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// ConfigGet returns the value of a dotted key such as models.gemini in cfg,
+// formatted as TOML unless it's a plain string
+func ConfigGet(cfg Config, key string) (string, error) {
+	tree, err := configTree(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	var value any = tree
+	for _, part := range strings.Split(key, ".") {
+		table, ok := value.(map[string]any)
+		if !ok {
+			return "", fmt.Errorf("%s is not set", key)
+		}
+		if value, ok = table[part]; !ok {
+			return "", fmt.Errorf("%s is not set", key)
+		}
+	}
+
+	var builder strings.Builder
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case map[string]any:
+		err = toml.NewEncoder(&builder).Encode(v)
+		return strings.TrimSpace(builder.String()), err
+	default:
+		// Let the encoder format everything else, e.g. arrays
+		err = toml.NewEncoder(&builder).Encode(map[string]any{"v": v})
+		return strings.TrimPrefix(strings.TrimSpace(builder.String()), "v = "), err
+	}
+}
+
+// ConfigSet sets a dotted key such as params.temperature in the config file
+// at configPath, creating it if need be. The value is TOML, e.g. 0.7 or
+// ["chatgpt", "gemini"]; anything which isn't valid TOML is taken as a
+// string. Note the file is rewritten, so comments are lost
+func ConfigSet(configPath string, key string, value string) error {
+	tree := map[string]any{}
+	if _, err := toml.DecodeFile(configPath, &tree); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to read config %s: %w", configPath, err)
+	}
+
+	var parsed map[string]any
+	if _, err := toml.Decode("v = "+value, &parsed); err != nil {
+		parsed = map[string]any{"v": value}
+	}
+
+	parts := strings.Split(key, ".")
+	table := tree
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := table[part].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			table[part] = next
+		}
+		table = next
+	}
+	table[parts[len(parts)-1]] = parsed["v"]
+
+	var builder strings.Builder
+	if err := toml.NewEncoder(&builder).Encode(tree); err != nil {
+		return err
+	}
+
+	// Make sure the result is still a config we understand
+	cfg := DefaultConfig()
+	md, err := toml.Decode(builder.String(), &cfg)
+	if err != nil {
+		return fmt.Errorf("can't set %s to %s: %w", key, value, err)
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		return fmt.Errorf("unknown setting %s", undecoded[0])
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	return os.WriteFile(configPath, []byte(builder.String()), 0644)
+}
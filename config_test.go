@@ -0,0 +1,248 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setupConfigFiles points the user config at a temporary file and moves to a
+// temporary project directory, writing whichever of the two are given
+func setupConfigFiles(t *testing.T, user string, project string) (string, string) {
+	userPath := filepath.Join(t.TempDir(), "config.toml")
+	t.Setenv(configPathEnv, userPath)
+
+	projectDir := t.TempDir()
+	t.Chdir(projectDir)
+	projectPath := filepath.Join(projectDir, projectConfigFile)
+
+	for path, content := range map[string]string{userPath: user, projectPath: project} {
+		if content == "" {
+			continue
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return userPath, projectPath
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	setupConfigFiles(t, `
+default_providers = ["gemini"]
+system_prompt = "From the user config"
+log_path = "/tmp/user.jsonl"
+
+[params]
+temperature = 0.5
+
+[[providers]]
+name = "Groq"
+flag = "gr"
+base_url = "https://api.groq.com/openai/v1"
+`, `
+default_providers = ["chatgpt", "groq"]
+
+[params]
+max_tokens = 100
+`)
+	t.Setenv("GOLLM_LOG_PATH", "/tmp/env.jsonl")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(cfg.DefaultProviders) != 2 || cfg.DefaultProviders[0] != "chatgpt" {
+		t.Errorf("Expected the project's default providers, got %v", cfg.DefaultProviders)
+	}
+	if cfg.Params.Temperature == nil || *cfg.Params.Temperature != 0.5 || cfg.Params.MaxTokens == nil || *cfg.Params.MaxTokens != 100 {
+		t.Errorf("Expected params from both files, got %+v", cfg.Params)
+	}
+	if len(cfg.Providers) != 1 || cfg.Providers[0].Name != "Groq" {
+		t.Errorf("Expected the user's providers, got %+v", cfg.Providers)
+	}
+	if cfg.LogPath != "/tmp/env.jsonl" {
+		t.Errorf("Expected the environment to beat the files, got %s", cfg.LogPath)
+	}
+	if cfg.Perplexity.SystemPrompt != "From the user config" {
+		t.Errorf("Expected the system prompt to reach Perplexity, got %q", cfg.Perplexity.SystemPrompt)
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	setupConfigFiles(t, "", `default_providers = ["nonesuch"]`)
+	if _, err := LoadConfig(); err == nil {
+		t.Error("Expected an error for an unknown default provider")
+	}
+
+	setupConfigFiles(t, "[params]\ntop_p = 2\n", "")
+	if _, err := LoadConfig(); err == nil {
+		t.Error("Expected an error for top_p 2")
+	}
+}
+
+func TestConfigSetGet(t *testing.T) {
+	userPath, _ := setupConfigFiles(t, "", "")
+
+	for key, value := range map[string]string{
+		"params.temperature": "0.7",
+		"default_providers":  `["gemini", "chatgpt"]`,
+		"models.gemini":      "models/gemini-2.5-flash",
+	} {
+		if err := ConfigSet(userPath, key, value); err != nil {
+			t.Fatalf("Unexpected error setting %s: %v", key, err)
+		}
+	}
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, want := range map[string]string{
+		"params.temperature": "0.7",
+		"default_providers":  `["gemini", "chatgpt"]`,
+		"models.gemini":      "models/gemini-2.5-flash",
+	} {
+		if got, err := ConfigGet(cfg, key); err != nil || got != want {
+			t.Errorf("Expected %s to be %s, got %s (%v)", key, want, got, err)
+		}
+	}
+
+	if err := ConfigSet(userPath, "nonesuch", "1"); err == nil {
+		t.Error("Expected an error for an unknown setting")
+	}
+	if err := ConfigSet(userPath, "params.temperature", "3"); err == nil {
+		t.Error("Expected an error for temperature 3")
+	}
+}
+
+func TestResolveBaseURL(t *testing.T) {
+	baseURLs = map[string]string{"Ollama": "http://gpu-box:11434/"}
+	defer func() { baseURLs = nil }()
+
+	t.Setenv("TEST_BASE_URL", "")
+	if got := ResolveBaseURL("ollama", "TEST_BASE_URL", "http://localhost:11434"); got != "http://gpu-box:11434" {
+		t.Errorf("Expected the config base URL, got %s", got)
+	}
+
+	t.Setenv("TEST_BASE_URL", "http://from-env")
+	if got := ResolveBaseURL("ollama", "TEST_BASE_URL", "http://localhost:11434"); got != "http://from-env" {
+		t.Errorf("Expected the environment to beat the config, got %s", got)
+	}
+
+	if got := ResolveBaseURL("gemini", "", "default"); got != "default" {
+		t.Errorf("Expected the default, got %s", got)
+	}
+}
+
+func TestProjectConfigWalksUp(t *testing.T) {
+	_, projectPath := setupConfigFiles(t, "", `
+context = ["docs/*.md"]
+`)
+	nested := filepath.Join(filepath.Dir(projectPath), "cmd", "tool")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(nested)
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(cfg.Context) != 1 || cfg.ContextDir != filepath.Dir(projectPath) {
+		t.Errorf("Expected context relative to %s, got %v in %s", filepath.Dir(projectPath), cfg.Context, cfg.ContextDir)
+	}
+}
+
+func TestProjectConfigUserOnly(t *testing.T) {
+	setupConfigFiles(t, `
+log_path = "/tmp/user.jsonl"
+
+[base_urls]
+ollama = "http://gpu-box:11434"
+`, `
+log_path = "/tmp/project.jsonl"
+system_prompt = "From the project"
+
+[base_urls]
+ollama = "http://evil.example"
+anthropic = "http://evil.example"
+
+[[providers]]
+name = "Thief"
+flag = "th"
+base_url = "http://evil.example"
+key_env = "OPENAI_API_KEY"
+`)
+	stderr := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	defer func() { os.Stderr = stderr }()
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.LogPath != "/tmp/user.jsonl" {
+		t.Errorf("Expected the project's log_path ignored, got %s", cfg.LogPath)
+	}
+	if len(cfg.BaseURLs) != 1 || cfg.BaseURLs["ollama"] != "http://gpu-box:11434" {
+		t.Errorf("Expected the project's base_urls ignored, got %v", cfg.BaseURLs)
+	}
+	if len(cfg.Providers) != 0 {
+		t.Errorf("Expected the project's providers ignored, got %+v", cfg.Providers)
+	}
+	if cfg.SystemPrompt != "From the project" {
+		t.Errorf("Expected the project's other settings kept, got %q", cfg.SystemPrompt)
+	}
+
+	if err := cmdConfig(cfg, []string{"set", "--project", "base_urls.ollama", `"http://evil.example"`}); err == nil {
+		t.Error("Expected config set --project to refuse base_urls")
+	}
+	if err := cmdConfig(cfg, []string{"set", "--project", "providers", `[{name = "Thief", base_url = "http://evil.example"}]`}); err == nil {
+		t.Error("Expected config set --project to refuse providers")
+	}
+}
+
+func TestDecodeProjectConfigKeepsLogAndBudget(t *testing.T) {
+	userPath, projectPath := setupConfigFiles(t, `
+[log]
+rotate = "monthly"
+max_age_days = 365
+
+[budget]
+daily_usd = 1.0
+
+[budget.providers.anthropic]
+monthly_usd = 5.0
+`, `
+[log]
+max_age_days = 1
+max_total_mb = 1
+
+[budget]
+daily_usd = 1000.0
+
+[budget.providers.anthropic]
+monthly_usd = 1000.0
+`)
+	stderr := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	defer func() { os.Stderr = stderr }()
+
+	cfg := DefaultConfig()
+	if err := decodeConfigFile(userPath, &cfg, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := decodeConfigFile(projectPath, &cfg, true); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Log != (LogConfig{Rotate: "monthly", Compress: true, MaxAgeDays: 365}) {
+		t.Errorf("Expected the project's log settings ignored, got %+v", cfg.Log)
+	}
+	if cfg.Budget.DailyUSD != 1 || cfg.Budget.Providers["anthropic"].MonthlyUSD != 5 {
+		t.Errorf("Expected the project's budget ignored, got %+v", cfg.Budget)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SourceContext marks a part of the prompt which came from a context file
+const SourceContext = "context"
+
+// ContextFile is a file whose contents are put before the prompt
+type ContextFile struct {
+	// Path is as shown to the user and the model, relative to the project
+	Path    string
+	Content string
+}
+
+// LoadContextFiles reads the files matching patterns, which are relative to
+// dir. A file matched by more than one pattern is only read once, and
+// patterns which match nothing are reported but aren't an error, so a moved
+// doc doesn't stop gollm working. A project's patterns, confined, only
+// match files inside dir, as they come with whatever repo was cloned and
+// could otherwise send, say, the user's SSH keys with every prompt
+func LoadContextFiles(patterns []string, dir string, confined bool) ([]ContextFile, error) {
+	var files []ContextFile
+	seen := map[string]bool{}
+
+	for _, pattern := range patterns {
+		if confined && filepath.IsAbs(pattern) {
+			fmt.Fprintf(os.Stderr, "Ignoring context %s: a project's context must be inside it\n", pattern)
+			continue
+		}
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("bad context pattern %q: %w", pattern, err)
+		}
+
+		found := false
+		for _, match := range matches {
+			if info, err := os.Stat(match); err != nil || info.IsDir() || seen[match] {
+				continue
+			}
+			if confined && !insideDir(dir, match) {
+				fmt.Fprintf(os.Stderr, "Ignoring context %s: a project's context must be inside it\n", match)
+				continue
+			}
+			seen[match] = true
+			found = true
+
+			content, err := os.ReadFile(match)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read context file: %w", err)
+			}
+
+			path := match
+			if rel, err := filepath.Rel(dir, match); err == nil && !strings.HasPrefix(rel, "..") {
+				path = filepath.ToSlash(rel)
+			}
+			files = append(files, ContextFile{Path: path, Content: string(content)})
+		}
+
+		if !found {
+			fmt.Fprintf(os.Stderr, "No context files match %s\n", pattern)
+		}
+	}
+
+	return files, nil
+}
+
+// insideDir is true if path, once any links are followed, is inside dir
+func insideDir(dir string, path string) bool {
+	if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+		dir = resolved
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dir, resolved)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// AttachContext puts the context files before the prompt, each wrapped in
+// tags naming the file, and shifts the sources to match
+func AttachContext(prompt string, sources []PromptSource, files []ContextFile) (string, []PromptSource) {
+	if len(files) == 0 {
+		return prompt, sources
+	}
+
+	var builder strings.Builder
+	var attached []PromptSource
+
+	for _, file := range files {
+		fmt.Fprintf(&builder, "<%s path=%q>\n", SourceContext, file.Path)
+		start := builder.Len()
+		builder.WriteString(strings.TrimSpace(file.Content))
+		attached = append(attached, PromptSource{Source: SourceContext, Start: start, End: builder.Len(), Path: file.Path})
+		fmt.Fprintf(&builder, "\n</%s>\n\n", SourceContext)
+	}
+
+	offset := builder.Len()
+	builder.WriteString(prompt)
+
+	for _, source := range sources {
+		source.Start += offset
+		source.End += offset
+		attached = append(attached, source)
+	}
+
+	return builder.String(), attached
+}
+
+// ContextPaths returns the paths of files, for the status header
+func ContextPaths(files []ContextFile) string {
+	paths := make([]string, len(files))
+	for idx, file := range files {
+		paths[idx] = file.Path
+	}
+	return strings.Join(paths, ", ")
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadContextFiles(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "docs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"docs/ARCHITECTURE.md": "Providers live in their own files.",
+		"docs/STYLE.md":        "Keep it simple.",
+		"README.md":            "gollm",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The architecture doc is matched twice but only read once
+	files, err := LoadContextFiles([]string{"docs/ARCHITECTURE.md", "docs/*.md", "missing.md"}, dir, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := ContextPaths(files); got != "docs/ARCHITECTURE.md, docs/STYLE.md" {
+		t.Errorf("Unexpected context files %s", got)
+	}
+}
+
+func TestLoadProjectContextFiles(t *testing.T) {
+	outside := t.TempDir()
+	secret := filepath.Join(outside, "id_rsa")
+	if err := os.WriteFile(secret, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := filepath.Join(outside, "project")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("gollm"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(secret, filepath.Join(dir, "linked.md")); err != nil {
+		t.Fatal(err)
+	}
+
+	stderr := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	defer func() { os.Stderr = stderr }()
+
+	patterns := []string{secret, "../id_*", "*.md", "docs/../README.md"}
+	files, err := LoadContextFiles(patterns, dir, true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := ContextPaths(files); got != "README.md" {
+		t.Errorf("Expected only the file inside the project, got %s", got)
+	}
+
+	// The user's own config can point anywhere
+	files, err = LoadContextFiles(patterns[:1], dir, false)
+	if err != nil || len(files) != 1 || files[0].Content != "secret" {
+		t.Errorf("Expected the user's own context read, got %+v (%v)", files, err)
+	}
+}
+
+func TestAttachContext(t *testing.T) {
+	prompt, sources := BuildPrompt("Summarize this", "Some text")
+	files := []ContextFile{{Path: "docs/ARCHITECTURE.md", Content: "Providers live in their own files.\n"}}
+
+	prompt, sources = AttachContext(prompt, sources, files)
+
+	want := "<context path=\"docs/ARCHITECTURE.md\">\nProviders live in their own files.\n</context>\n\nSummarize this\n\n<stdin>\nSome text\n</stdin>"
+	if prompt != want {
+		t.Errorf("Expected %q, got %q", want, prompt)
+	}
+
+	if len(sources) != 3 {
+		t.Fatalf("Expected 3 sources, got %v", sources)
+	}
+	for idx, want := range []string{"Providers live in their own files.", "Summarize this", "Some text"} {
+		if got := prompt[sources[idx].Start:sources[idx].End]; got != want {
+			t.Errorf("Expected source %d to be %q, got %q", idx, want, got)
+		}
+	}
+	if sources[0].Source != SourceContext || sources[0].Path != "docs/ARCHITECTURE.md" {
+		t.Errorf("Unexpected context source %v", sources[0])
+	}
+}
@@ -4,29 +4,185 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"os"
 	"strings"
-	"time"
 
 	"github.com/google/generative-ai-go/genai"
 	"google.golang.org/api/iterator"
 	"google.golang.org/api/option"
 )
 
-// ListGeminiModels will list Gemini models which are available
-func ListGeminiModels() string {
-	var builder strings.Builder
+const geminiApiKey = "GEMINI_API_KEY"
 
-	// --- Get API Key ---
-	apiKey := GetGeminiAPIKeyOrBail()
+const geminiDefaultModel = "models/gemini-2.5-pro"
 
-	// --- Set up the Gemini client ---
-	ctx := context.Background()
+type geminiProvider struct{}
+
+func init() {
+	RegisterProvider(geminiProvider{})
+}
+
+func (geminiProvider) Name() string   { return "Gemini" }
+func (geminiProvider) Flag() string   { return "g" }
+func (geminiProvider) EnvKey() string { return geminiApiKey }
+
+func (geminiProvider) Capabilities() Capabilities {
+	return Capabilities{ListModels: true, Stream: true, Params: ParamSupport{Temperature: true, MaxTokens: true, TopP: true, Stop: true}}
+}
+
+func (geminiProvider) ListModels(ctx context.Context) (string, error) {
+	return ListGeminiModels(ctx)
+}
+
+func (geminiProvider) Complete(ctx context.Context, req Request) (ModelResponse, error) {
+	modelName := req.ModelOr(geminiDefaultModel)
+
+	var resp *genai.GenerateContentResponse
+	if req.Mock {
+		resp = MockGenerateContentResponse()
+	} else {
+		client, err := geminiClient(ctx)
+		if err != nil {
+			return ModelResponse{}, err
+		}
+
+		// Ensure the client is closed when we're done
+		defer client.Close()
+
+		resp, err = GeminiCallAPI(geminiChat(client, modelName, req), req.Prompt, ctx, req.Mock)
+		if err != nil {
+			return ModelResponse{}, err
+		}
+	}
+
+	return modelResponseFromGemini(resp, modelName)
+}
+
+func (geminiProvider) Stream(ctx context.Context, req Request, onToken func(string)) (ModelResponse, error) {
+	modelName := req.ModelOr(geminiDefaultModel)
+
+	client, err := geminiClient(ctx)
+	if err != nil {
+		return ModelResponse{}, err
+	}
+	defer client.Close()
+
+	iter := geminiChat(client, modelName, req).SendMessageStream(ctx, genai.Text(req.Prompt))
+	for {
+		resp, err := iter.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return ModelResponse{}, fmt.Errorf("failed to generate content: %w", err)
+		}
+
+		for _, cand := range resp.Candidates {
+			if cand.Content == nil {
+				continue
+			}
+			for _, part := range cand.Content.Parts {
+				if textPart, ok := part.(genai.Text); ok {
+					onToken(string(textPart))
+				}
+			}
+		}
+	}
+
+	// The merged response has the content, finish reason and usage of the whole stream
+	return modelResponseFromGemini(iter.MergedResponse(), modelName)
+}
+
+// geminiModel returns the model set up for req, with the system prompt as
+// its system instruction and the params in its generation config
+func geminiModel(client *genai.Client, modelName string, req Request) *genai.GenerativeModel {
+	model := client.GenerativeModel(modelName)
+	if req.System != "" {
+		model.SystemInstruction = genai.NewUserContent(genai.Text(req.System))
+	}
+
+	if req.Params.Temperature != nil {
+		model.SetTemperature(float32(*req.Params.Temperature))
+	}
+	if req.Params.MaxTokens != nil {
+		model.SetMaxOutputTokens(int32(*req.Params.MaxTokens))
+	}
+	if req.Params.TopP != nil {
+		model.SetTopP(float32(*req.Params.TopP))
+	}
+	model.StopSequences = req.Params.Stop
+
+	return model
+}
+
+// geminiChat starts a chat session with the model set up for req, carrying
+// on from its history
+func geminiChat(client *genai.Client, modelName string, req Request) *genai.ChatSession {
+	cs := geminiModel(client, modelName, req).StartChat()
+	for _, message := range req.History {
+		// Gemini calls the assistant the model
+		role := "user"
+		if message.Role == "assistant" {
+			role = "model"
+		}
+		cs.History = append(cs.History, &genai.Content{Role: role, Parts: []genai.Part{genai.Text(message.Content)}})
+	}
+	return cs
+}
+
+// geminiClient creates a client authenticated with the API key
+func geminiClient(ctx context.Context) (*genai.Client, error) {
+	apiKey, err := RequireAPIKey(geminiApiKey)
+	if err != nil {
+		return nil, err
+	}
 
 	// Use option.WithAPIKey to authenticate with an API key
-	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
+	opts := []option.ClientOption{option.WithAPIKey(apiKey)}
+	if endpoint := ResolveBaseURL(geminiProvider{}.Name(), "", ""); endpoint != "" {
+		opts = append(opts, option.WithEndpoint(endpoint))
+	}
+	client, err := genai.NewClient(ctx, opts...)
 	if err != nil {
-		Fatalf("Failed to create client: %v", err)
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+	return client, nil
+}
+
+func modelResponseFromGemini(resp *genai.GenerateContentResponse, modelName string) (ModelResponse, error) {
+	buffer, finishReason, safetyRating, err := StringifyGeminiResponse(resp, modelName)
+	if err != nil {
+		return ModelResponse{}, err
+	}
+
+	response := ModelResponse{
+		Model:        modelName,
+		Content:      buffer,
+		FinishReason: finishReason,
+		SafetyRating: safetyRating,
+	}
+
+	if resp != nil && resp.UsageMetadata != nil {
+		usage := resp.UsageMetadata
+		response.TotalTokens = int(usage.TotalTokenCount)
+		response.PromptTokens = int(usage.PromptTokenCount)
+		response.CachedTokens = int(usage.CachedContentTokenCount)
+		// Thinking isn't in the candidates but is in the total, and this
+		// SDK doesn't count it separately
+		response.ReasoningTokens = max(response.TotalTokens-response.PromptTokens-int(usage.CandidatesTokenCount), 0)
+		response.CompletionTokens = int(usage.CandidatesTokenCount) + response.ReasoningTokens
+	}
+
+	return response, nil
+}
+
+// ListGeminiModels will list Gemini models which are available
+func ListGeminiModels(ctx context.Context) (string, error) {
+	var builder strings.Builder
+
+	// --- Set up the Gemini client ---
+	client, err := geminiClient(ctx)
+	if err != nil {
+		return "", err
 	}
 
 	// Ensure the client is closed when main function finishes
@@ -47,7 +203,7 @@ func ListGeminiModels() string {
 
 		if err != nil {
 			// Handle any other error during iteration
-			Fatalf("Failed to iterate models: %v", err)
+			return "", fmt.Errorf("failed to iterate models: %w", err)
 		}
 
 		// Note that we're only interested in models with generateContent in SupportedGenerationMethods
@@ -64,18 +220,18 @@ func ListGeminiModels() string {
 	}
 	builder.WriteString("--- End of List ---\n")
 
-	return builder.String()
+	return builder.String(), nil
 }
 
 // StringifyGeminiResponse is a helper function to print the response content
 // it returns response, finishReason, safetyRating
-func StringifyGeminiResponse(resp *genai.GenerateContentResponse, model string) (string, string, string) {
+func StringifyGeminiResponse(resp *genai.GenerateContentResponse, model string) (string, string, string, error) {
 	var response strings.Builder
 	var finishReason string = ""
 	var safetyRating strings.Builder
 
 	if resp == nil || len(resp.Candidates) == 0 {
-		return "Received an empty response.", "", ""
+		return "Received an empty response.", "", "", nil
 	}
 	// impliedly the response is not nil or of length 0
 
@@ -88,11 +244,11 @@ func StringifyGeminiResponse(resp *genai.GenerateContentResponse, model string)
 					response.WriteString(string(textPart))
 				} else {
 					// It's not genai.Text (could be ImageData, FunctionCall, etc.)
-					Fatalf("Part is not genai.Text, it's type %T\n", part)
+					return "", "", "", fmt.Errorf("part is not genai.Text, it's type %T", part)
 				}
 			}
 		} else {
-			return "Candidate content is nil.", "", ""
+			return "Candidate content is nil.", "", "", nil
 		}
 
 		// If there's a safety rating then stringify it
@@ -115,7 +271,7 @@ func StringifyGeminiResponse(resp *genai.GenerateContentResponse, model string)
 		finishReason = "None"
 	}
 
-	return response.String(), finishReason, safetyRating.String()
+	return response.String(), finishReason, safetyRating.String(), nil
 }
 
 func MockGenerateContentResponse() *genai.GenerateContentResponse {
@@ -153,91 +309,16 @@ func MockGenerateContentResponse() *genai.GenerateContentResponse {
 	return mockResponse
 }
 
-func GeminiCallAPI(modelName string, promptText string, ctx context.Context, client *genai.Client, mock bool) (*genai.GenerateContentResponse, error) {
+func GeminiCallAPI(cs *genai.ChatSession, promptText string, ctx context.Context, mock bool) (*genai.GenerateContentResponse, error) {
 	if mock {
 		return MockGenerateContentResponse(), nil
 	}
-	// --- 3. Select the model ---
-	model := client.GenerativeModel(modelName)
-
-	resp, err := model.GenerateContent(ctx, genai.Text(promptText))
-
-	if err != nil {
-		Fatalf("Failed to generate content: %v", err)
-	}
-
-	return resp, err
-}
 
-// GeminiLowerWrapper calls the Gemini API
-func GeminiLowerWrapper(promptText string, ctx context.Context, client *genai.Client, mock bool, logToJsonl bool, quietMode bool) string {
-	// Start the timer
-	startTime := time.Now()
-	modelName := "models/gemini-2.5-pro-preview-03-25"
-
-	resp, err := GeminiCallAPI(modelName, promptText, ctx, client, mock)
+	resp, err := cs.SendMessage(ctx, genai.Text(promptText))
 
 	if err != nil {
-		Fatalf("Some issue: %s", err)
-	}
-
-	buffer, finishReason, safetyRating := StringifyGeminiResponse(resp, modelName)
-	totalTokenCount := resp.UsageMetadata.TotalTokenCount
-	duration := time.Since(startTime)
-
-	// Log successful model call only if logging is enabled
-	if logToJsonl {
-		logEntry := LogEntry{
-			ModelName:     modelName,
-			TotalTokens:   int(totalTokenCount),
-			Duration:      duration.Seconds(),
-			StopReason:    finishReason,
-			PromptText:    promptText,
-			ModelResponse: buffer,
-			Timestamp:     time.Now(),
-		}
-		if err := WriteLogEntry(logEntry); err != nil {
-			// Log error but don't fail the request
-			fmt.Fprintf(os.Stderr, "Failed to write log entry: %v\n", err)
-		}
+		return nil, fmt.Errorf("failed to generate content: %w", err)
 	}
 
-	if quietMode {
-		return buffer
-	}
-
-	if safetyRating != "" {
-		return fmt.Sprintf("\nModel: %s, %d tokens used, finished due to: %s, safety rating: %s, duration: %.3f seconds\n\n%s\n", modelName, totalTokenCount, finishReason, safetyRating, duration.Seconds(), buffer)
-	} else {
-		return fmt.Sprintf("\nModel: %s, %d tokens used, finished due to: %s, duration: %.3f seconds\n\n%s\n", modelName, totalTokenCount, finishReason, duration.Seconds(), buffer)
-	}
-}
-
-func GeminiMiddleWrapper(promptText string, mock bool, logToJsonl bool, quietMode bool) string {
-	// --- Get API Key ---
-	apiKey := GetGeminiAPIKeyOrBail()
-
-	// --- Set up the Gemini client ---
-	ctx := context.Background()
-
-	// Use option.WithAPIKey to authenticate with an API key
-	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
-	if err != nil {
-		Fatalf("Failed to create client: %v", err)
-	}
-
-	// Ensure the client is closed when main function finishes
-	defer client.Close()
-
-	output := GeminiLowerWrapper(promptText, ctx, client, mock, logToJsonl, quietMode)
-
-	return output
-}
-
-func GeminiWrapper(promptText string, mock bool, logToJsonl bool, quietMode bool) string {
-	s := GeminiMiddleWrapper(promptText, mock, logToJsonl, quietMode) + "\n"
-	if quietMode {
-		return s
-	}
-	return fmt.Sprintf("# Gemini\n%s\n", s)
+	return resp, nil
 }
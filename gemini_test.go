@@ -1,8 +1,33 @@
 package main
 
-import "testing"
+import (
+	"context"
+	"testing"
 
-func TestGeminiWrapper(t *testing.T) {
+	"github.com/google/generative-ai-go/genai"
+)
+
+func TestGeminiProvider(t *testing.T) {
 	quietMode = true
-	Render(GeminiWrapper("Mock prompt", true, false, quietMode))
+	response, duration, err := CompleteProvider(context.Background(), geminiProvider{}, Request{Prompt: "Mock prompt", Mock: true}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Render(FmtModelResponse(geminiProvider{}.Name(), response, duration, quietMode))
+}
+
+func TestGeminiTokens(t *testing.T) {
+	resp := &genai.GenerateContentResponse{
+		Candidates:    []*genai.Candidate{{Content: &genai.Content{Role: "model", Parts: []genai.Part{genai.Text("Hi")}}, FinishReason: genai.FinishReasonStop}},
+		UsageMetadata: &genai.UsageMetadata{PromptTokenCount: 20, CachedContentTokenCount: 5, CandidatesTokenCount: 10, TotalTokenCount: 36},
+	}
+
+	response, err := modelResponseFromGemini(resp, "models/gemini-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The thinking is what's left of the total
+	if response.PromptTokens != 20 || response.CachedTokens != 5 || response.CompletionTokens != 16 || response.ReasoningTokens != 6 {
+		t.Errorf("Unexpected tokens %+v", response)
+	}
 }
@@ -0,0 +1,21 @@
+//go:build !unix && !windows
+
+package main
+
+import "os"
+
+// lockFile does nothing where there's no file locking, leaving writes only
+// safe within one process
+func lockFile(file *os.File) error {
+	return nil
+}
+
+// lockFileShared does nothing, like lockFile
+func lockFileShared(file *os.File) error {
+	return nil
+}
+
+// unlockFile does nothing, as lockFile didn't lock
+func unlockFile(file *os.File) error {
+	return nil
+}
@@ -0,0 +1,25 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// lockFile takes an exclusive advisory lock on file, waiting for it
+func lockFile(file *os.File) error {
+	return unix.Flock(int(file.Fd()), unix.LOCK_EX)
+}
+
+// lockFileShared takes a shared advisory lock on file, waiting for any
+// exclusive one to go
+func lockFileShared(file *os.File) error {
+	return unix.Flock(int(file.Fd()), unix.LOCK_SH)
+}
+
+// unlockFile releases the lock taken by lockFile
+func unlockFile(file *os.File) error {
+	return unix.Flock(int(file.Fd()), unix.LOCK_UN)
+}
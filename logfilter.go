@@ -0,0 +1,165 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultPageSize is the number of entries on a page of log list when
+// --page is given without --limit
+const defaultPageSize = 20
+
+// LogFilter picks entries from the log; the zero value picks them all
+type LogFilter struct {
+	// Model is part of the model name, in any case
+	Model string
+	// Since and Until bound the timestamp, Until being exclusive
+	Since time.Time
+	Until time.Time
+	// Grep is matched against the prompt and the response
+	Grep       *regexp.Regexp
+	MinTokens  int
+	StopReason string
+}
+
+// Match is true if entry passes every part of the filter
+func (filter LogFilter) Match(entry LogEntry) bool {
+	if filter.Model != "" && !strings.Contains(strings.ToLower(entry.ModelName), strings.ToLower(filter.Model)) {
+		return false
+	}
+	if !filter.Since.IsZero() && entry.Timestamp.Before(filter.Since) {
+		return false
+	}
+	if !filter.Until.IsZero() && !entry.Timestamp.Before(filter.Until) {
+		return false
+	}
+	if entry.TotalTokens < filter.MinTokens {
+		return false
+	}
+	if filter.StopReason != "" && !strings.EqualFold(entry.StopReason, filter.StopReason) {
+		return false
+	}
+	if filter.Grep != nil && !filter.Grep.MatchString(entry.PromptText) && !filter.Grep.MatchString(entry.ModelResponse) {
+		return false
+	}
+	return true
+}
+
+// LogPage is a page of the entries which matched a filter, newest first
+type LogPage struct {
+	Entries []LogEntry
+	// Matched is how many entries matched in all, and Offset how many newer
+	// ones come before the page
+	Matched int
+	Offset  int
+}
+
+// QueryLog returns the entries matching filter, newest first, skipping
+// offset of them and returning at most limit, or all if limit is 0. The
+// log is streamed and only the newest offset+limit matches are kept, or
+// every match if limit is 0. Either way only what the list shows of each
+// is kept, the start of the prompt but not the response, so it's never all
+// in memory
+func QueryLog(filter LogFilter, limit int, offset int) (LogPage, error) {
+	page := LogPage{Offset: offset}
+	keep := offset + limit
+
+	// The oldest match kept is at the top, to make way for newer ones
+	var newest logHeap
+	err := ScanLogSince(filter.Since, func(entry LogEntry) {
+		if !filter.Match(entry) {
+			return
+		}
+		// The list shows the start of the prompt and nothing else long, so
+		// we don't hold on to the rest. The prompt's copied so the whole of
+		// it can go
+		if len(entry.PromptText) > logPreviewLength {
+			entry.PromptText = strings.Clone(entry.PromptText[:logPreviewLength+1])
+		}
+		entry.ModelResponse = ""
+		entry.SystemPrompt = ""
+		entry.PromptSources = nil
+		entry.Images = nil
+		entry.RelatedQuestions = nil
+
+		heap.Push(&newest, seqEntry{entry: entry, seq: page.Matched})
+		page.Matched++
+		if limit > 0 && newest.Len() > keep {
+			heap.Pop(&newest)
+		}
+	})
+	if err != nil {
+		return LogPage{}, err
+	}
+
+	sort.Slice(newest, func(i int, j int) bool {
+		return newest[j].before(newest[i])
+	})
+	for i := offset; i < len(newest); i++ {
+		page.Entries = append(page.Entries, newest[i].entry)
+	}
+	return page, nil
+}
+
+// seqEntry is a log entry and its place in the log, which orders entries
+// written at the same time
+type seqEntry struct {
+	entry LogEntry
+	seq   int
+}
+
+func (e seqEntry) before(other seqEntry) bool {
+	if !e.entry.Timestamp.Equal(other.entry.Timestamp) {
+		return e.entry.Timestamp.Before(other.entry.Timestamp)
+	}
+	return e.seq < other.seq
+}
+
+// logHeap is a min-heap of entries, oldest first
+type logHeap []seqEntry
+
+func (h logHeap) Len() int           { return len(h) }
+func (h logHeap) Less(i, j int) bool { return h[i].before(h[j]) }
+func (h logHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *logHeap) Push(x any)        { *h = append(*h, x.(seqEntry)) }
+func (h *logHeap) Pop() any {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
+
+// logTimeLayouts are the forms --since and --until take, besides a
+// duration ago
+var logTimeLayouts = []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"}
+
+// ParseLogTime parses value as a time, e.g. 2025-05-01 or 2025-05-01 14:30
+// in local time, or as how long ago, e.g. 36h or 7d. A bare date taken as an
+// end of a range, with end true, takes in all of that day
+func ParseLogTime(value string, now time.Time, end bool) (time.Time, error) {
+	if days, found := strings.CutSuffix(value, "d"); found {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if ago, err := time.ParseDuration(value); err == nil && ago >= 0 {
+		return now.Add(-ago), nil
+	}
+
+	for _, layout := range logTimeLayouts {
+		t, err := time.ParseInLocation(layout, value, time.Local)
+		if err != nil {
+			continue
+		}
+		if end && layout == "2006-01-02" {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%q isn't a time such as 2025-05-01, 2025-05-01 14:30, 36h or 7d", value)
+}
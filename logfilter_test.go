@@ -0,0 +1,105 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryLog(t *testing.T) {
+	logPath = filepath.Join(t.TempDir(), "gollm_logs.jsonl")
+	t.Cleanup(func() { logPath = "" })
+
+	start := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, model := range []string{"gpt-4o", "claude-sonnet", "gpt-4o-mini", "gpt-4.1", "gemini-2.5-pro"} {
+		entry := LogEntry{ModelName: model, TotalTokens: i * 100, PromptText: "Prompt", ModelResponse: "Answer", StopReason: "stop", Timestamp: start.Add(time.Duration(i) * time.Hour)}
+		if err := WriteLogEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	page, err := QueryLog(LogFilter{Model: "GPT"}, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Matched != 3 || len(page.Entries) != 2 || page.Entries[0].ModelName != "gpt-4.1" || page.Entries[1].ModelName != "gpt-4o-mini" {
+		t.Errorf("Expected the newest two of three GPT entries, got %+v", page)
+	}
+	if page.Entries[0].ModelResponse != "" {
+		t.Error("Expected the responses to be left out")
+	}
+
+	page, err = QueryLog(LogFilter{Model: "gpt"}, 2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Entries) != 1 || page.Entries[0].ModelName != "gpt-4o" {
+		t.Errorf("Expected the oldest GPT entry on page 2, got %+v", page.Entries)
+	}
+
+	// With no limit every match is kept, but only as much as the list shows
+	long := LogEntry{ModelName: "long", PromptText: strings.Repeat("x", 10000), SystemPrompt: "Be brief", Timestamp: start}
+	if err := WriteLogEntry(long); err != nil {
+		t.Fatal(err)
+	}
+	page, err = QueryLog(LogFilter{Model: "long"}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Entries) != 1 {
+		t.Fatalf("Expected the long entry, got %+v", page.Entries)
+	}
+	if len(page.Entries[0].PromptText) != logPreviewLength+1 || page.Entries[0].SystemPrompt != "" {
+		t.Errorf("Expected just the start of the prompt, got %d bytes and %q", len(page.Entries[0].PromptText), page.Entries[0].SystemPrompt)
+	}
+
+	page, err = QueryLog(LogFilter{Since: start.Add(time.Hour), Until: start.Add(3 * time.Hour), MinTokens: 200}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Entries) != 1 || page.Entries[0].ModelName != "gpt-4o-mini" {
+		t.Errorf("Expected just gpt-4o-mini in the range, got %+v", page.Entries)
+	}
+}
+
+func TestLogFilterMatch(t *testing.T) {
+	entry := LogEntry{PromptText: "Explain goroutines", ModelResponse: "A goroutine is a lightweight thread", StopReason: "max_tokens"}
+
+	if !(LogFilter{Grep: regexp.MustCompile(`lightweight\s+thread`)}).Match(entry) {
+		t.Error("Expected grep to match the response")
+	}
+	if (LogFilter{Grep: regexp.MustCompile(`channels`)}).Match(entry) {
+		t.Error("Expected grep not to match")
+	}
+	if !(LogFilter{StopReason: "MAX_TOKENS"}).Match(entry) || (LogFilter{StopReason: "stop"}).Match(entry) {
+		t.Error("Expected the stop reason to be matched in any case")
+	}
+}
+
+func TestParseLogTime(t *testing.T) {
+	now := time.Date(2025, 5, 10, 12, 0, 0, 0, time.Local)
+
+	cases := []struct {
+		value string
+		end   bool
+		want  time.Time
+	}{
+		{"7d", false, now.AddDate(0, 0, -7)},
+		{"36h", false, now.Add(-36 * time.Hour)},
+		{"2025-05-01", false, time.Date(2025, 5, 1, 0, 0, 0, 0, time.Local)},
+		{"2025-05-01", true, time.Date(2025, 5, 2, 0, 0, 0, 0, time.Local)},
+		{"2025-05-01 14:30", true, time.Date(2025, 5, 1, 14, 30, 0, 0, time.Local)},
+	}
+	for _, c := range cases {
+		got, err := ParseLogTime(c.value, now, c.end)
+		if err != nil || !got.Equal(c.want) {
+			t.Errorf("ParseLogTime(%q, %v) = %v (%v), want %v", c.value, c.end, got, err, c.want)
+		}
+	}
+
+	if _, err := ParseLogTime("last week", now, false); err == nil {
+		t.Error("Expected an error for an unknown time")
+	}
+}
@@ -3,29 +3,74 @@ package main
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
-	"sort"
 	"strings"
 	"time"
+
+	"github.com/google/uuid"
 )
 
+// shortIDLength is how much of an entry or session ID we show; any prefix
+// which is unique will find it
+const shortIDLength = 8
+
+// legacyIDSpace is the namespace of the IDs derived for entries written
+// before entries had IDs
+var legacyIDSpace = uuid.MustParse("6f1c2a4e-5b0d-4c8e-9a7f-3d2e1b0c9a8f")
+
 // LogEntry represents a single log entry for model calls
 type LogEntry struct {
-	ModelName     string    `json:"model_name"`
-	TotalTokens   int       `json:"total_tokens"`
-	Duration      float64   `json:"duration_seconds"`
-	StopReason    string    `json:"stop_reason"`
-	PromptText    string    `json:"prompt_text"`
-	ModelResponse string    `json:"model_response"`
-	Timestamp     time.Time `json:"timestamp"`
+	// ID is given when the entry is written, see legacyEntryID for older ones
+	ID       string `json:"id,omitempty"`
+	Provider string `json:"provider,omitempty"`
+	// SessionID links the turns of a conversation, which are numbered from 1
+	SessionID   string `json:"session_id,omitempty"`
+	Turn        int    `json:"turn,omitempty"`
+	ModelName   string `json:"model_name"`
+	TotalTokens int    `json:"total_tokens"`
+	// The split of the total, as in ModelResponse; entries from before it
+	// was logged have only the total
+	PromptTokens     int     `json:"prompt_tokens,omitempty"`
+	CompletionTokens int     `json:"completion_tokens,omitempty"`
+	CachedTokens     int     `json:"cached_tokens,omitempty"`
+	ReasoningTokens  int     `json:"reasoning_tokens,omitempty"`
+	Duration         float64 `json:"duration_seconds"`
+	StopReason       string  `json:"stop_reason"`
+	// SystemPrompt is the system prompt sent with the prompt, if any
+	SystemPrompt string `json:"system_prompt,omitempty"`
+	PromptText   string `json:"prompt_text"`
+	// Params are the generation params we set, the rest being the
+	// provider's defaults
+	Params GenerationParams `json:"params,omitzero"`
+	// PromptSources are the byte ranges of PromptText which came from the
+	// arguments and from stdin
+	PromptSources []PromptSource `json:"prompt_sources,omitempty"`
+	ModelResponse string         `json:"model_response"`
+	Timestamp     time.Time      `json:"timestamp"`
+	// Images and RelatedQuestions are from search providers
+	Images           []string `json:"images,omitempty"`
+	RelatedQuestions []string `json:"related_questions,omitempty"`
+	// Retries and RetryWait are how often and how long we waited on failures
+	Retries   int     `json:"retries,omitempty"`
+	RetryWait float64 `json:"retry_wait_seconds,omitempty"`
 }
 
+// logPath is set by main from the config, overriding the default
+var logPath string
+
 func getLogPath() (string, error) {
 	var err error = nil
 	const logFn string = "gollm_logs.jsonl"
 
+	if logPath != "" {
+		return expandHome(logPath)
+	}
+
 	// Get user's home directory
 	// Note: %w is the special formatting for errors
 	homeDir, err := os.UserHomeDir()
@@ -40,9 +85,39 @@ func getLogPath() (string, error) {
 	return logFilePath, err
 }
 
+// expandHome replaces a leading ~ in path with the user's home directory
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %w", err)
+	}
+	return filepath.Join(homeDir, path[1:]), nil
+}
+
+// shortID is the start of id we show
+func shortID(id string) string {
+	if len(id) > shortIDLength {
+		return id[:shortIDLength]
+	}
+	return id
+}
+
+// legacyEntryID derives an ID for an entry written before entries had
+// them from its line in the log, so it's the same each time it's read
+func legacyEntryID(line []byte) string {
+	return uuid.NewSHA1(legacyIDSpace, line).String()
+}
+
+// logPreviewLength is how much of the prompt log list shows
+const logPreviewLength = 120
+
 // printLogEntry
 // is a helper function to print the log entry
-func printLogEntry(i int, r LogEntry, incResponse bool) {
+func printLogEntry(r LogEntry, incResponse bool) {
 	if incResponse {
 		Render(r.ModelResponse)
 		return
@@ -51,35 +126,99 @@ func printLogEntry(i int, r LogEntry, incResponse bool) {
 	var prompt string
 
 	niceTimestamp := r.Timestamp.Format("2006-01-02 15:04:05")
-	if len(r.PromptText) > 120 {
-		prompt = r.PromptText[:120] + " ..."
+	if len(r.PromptText) > logPreviewLength {
+		prompt = r.PromptText[:logPreviewLength] + " ..."
 	} else {
 		prompt = r.PromptText
 	}
 
 	// let's indent the prompt by replacing each \n with \t\n
 	prompt = strings.ReplaceAll(prompt, "\n", "\n\t")
-	fmt.Printf("%d :: %s :: %s\n\t> %s\n\n", i, niceTimestamp, r.ModelName, prompt)
+
+	var session string
+	if r.SessionID != "" {
+		session = fmt.Sprintf(" :: session %s turn %d", shortID(r.SessionID), r.Turn)
+	}
+	fmt.Printf("%s :: %s :: %s%s\n\t> %s\n\n", shortID(r.ID), niceTimestamp, r.ModelName, session, prompt)
 }
 
-// ReadLogIdx
-// pass in a negative logIdx to print all
-func ReadLogIdx(logIdx int) error {
-	var logEntries []LogEntry
+// maxLogLine is the longest line we read from the log, as a line holds the
+// whole prompt and response
+const maxLogLine = 64 * 1024 * 1024
+
+// ScanLog calls fn with each entry in the log in the order they were
+// written, a line at a time rather than reading the whole log into memory.
+// The rotated segments are read first, then the file being written
+func ScanLog(fn func(LogEntry)) error {
+	return ScanLogSince(time.Time{}, fn)
+}
 
+// ScanLogSince is ScanLog, but may leave out entries from before since by
+// skipping the segments which end before it. fn should still check the time
+func ScanLogSince(since time.Time, fn func(LogEntry)) error {
 	logFilePath, err := getLogPath()
 	if err != nil {
 		return err
 	}
 
-	// Open file
-	file, err := os.OpenFile(logFilePath, os.O_RDONLY, 0)
+	// The segments are listed and the file being written opened together,
+	// under the lock, as a rotation between the two would move entries into
+	// a segment we hadn't listed. Once open, it can be rotated while read
+	var files []string
+	var live io.ReadCloser
+	err = withSharedLogLock(logFilePath, func() error {
+		files, err = logFiles(logFilePath, since)
+		if err != nil {
+			return err
+		}
+		live, err = openLogFile(logFilePath)
+		// The file being written may not exist yet, if it's just been rotated
+		if errors.Is(err, fs.ErrNotExist) && len(files) > 1 {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, path := range files[:len(files)-1] {
+		err := scanLogFile(path, fn)
+		// A segment may have expired since it was listed
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if live == nil {
+		return nil
+	}
+	defer live.Close()
+	return scanLogLines(logFilePath, live, fn)
+}
+
+// scanLogFile calls fn with each entry in one file of the log
+func scanLogFile(path string, fn func(LogEntry)) error {
+	file, err := openLogFile(path)
 	if err != nil {
 		return fmt.Errorf("failed to open log file: %w", err)
 	}
 	defer file.Close()
 
+	return scanLogLines(path, file, fn)
+}
+
+// scanLogLines calls fn with each entry read from file, which is the file of
+// the log at path
+func scanLogLines(path string, file io.Reader, fn func(LogEntry)) error {
 	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLogLine)
 	lineNo := 0
 
 	for scanner.Scan() {
@@ -95,37 +234,106 @@ func ReadLogIdx(logIdx int) error {
 		err := json.Unmarshal(lineBytes, &logEntry)
 		if err != nil {
 			// If an error print and skip
-			fmt.Printf("Error unmarshalling line %d (%s): %v", lineNo, string(lineBytes), err)
+			fmt.Fprintf(os.Stderr, "Error unmarshalling line %d of %s (%s): %v\n", lineNo, path, string(lineBytes), err)
 			continue
 		}
-		logEntries = append(logEntries, logEntry)
+		if logEntry.ID == "" {
+			logEntry.ID = legacyEntryID(lineBytes)
+		}
+		fn(logEntry)
 	}
 
 	if err := scanner.Err(); err != nil {
-		Fatalf("Error reading file %s: %v", logFilePath, err)
+		return fmt.Errorf("error reading file %s: %w", path, err)
 	}
+	return nil
+}
 
-	sort.Slice(logEntries, func(i int, j int) bool {
-		return logEntries[i].Timestamp.After(logEntries[j].Timestamp)
-	})
+// ListLog prints an index of the entries matching filter, newest first,
+// limited to a page if limit isn't 0
+func ListLog(filter LogFilter, limit int, page int) error {
+	logPage, err := QueryLog(filter, limit, (page-1)*limit)
+	if err != nil {
+		return err
+	}
+
+	for _, r := range logPage.Entries {
+		printLogEntry(r, false)
+	}
 
-	if logIdx < 0 {
-		for i, r := range logEntries {
-			printLogEntry(i, r, false)
+	if limit > 0 && logPage.Matched > 0 {
+		shown := fmt.Sprintf("Showing %d-%d of %d", logPage.Offset+1, logPage.Offset+len(logPage.Entries), logPage.Matched)
+		if len(logPage.Entries) == 0 {
+			shown = fmt.Sprintf("Page %d is past the end of the %d entries", page, logPage.Matched)
 		}
-	} else {
-		nLogEntries := len(logEntries)
-		if logIdx+1 > nLogEntries {
-			Fatalf("Idx %d doesn't make sense when we have %d log entries", logIdx, nLogEntries)
+		if logPage.Offset+len(logPage.Entries) < logPage.Matched {
+			shown += fmt.Sprintf(", see --page %d for more", page+1)
+		}
+		Print(shown)
+	}
+	return nil
+}
+
+// FindLogEntry returns the index in entries of the entry whose ID starts
+// with prefix, which has to be unique
+func FindLogEntry(entries []LogEntry, prefix string) (int, error) {
+	found := -1
+	for i, entry := range entries {
+		if prefix == "" || !strings.HasPrefix(entry.ID, prefix) {
+			continue
+		}
+		if found >= 0 {
+			return -1, fmt.Errorf("more than one log entry starts with %s, give more of its ID", prefix)
 		}
-		printLogEntry(logIdx, logEntries[logIdx], true)
+		found = i
 	}
 
+	if found < 0 {
+		return -1, fmt.Errorf("no log entry starts with %q, see log list", prefix)
+	}
+	return found, nil
+}
+
+// LookupLogEntry returns the entry in the log whose ID starts with prefix,
+// which has to be unique. The log is streamed, holding on to no more than
+// the two matches it takes to tell the prefix isn't unique
+func LookupLogEntry(prefix string) (LogEntry, error) {
+	var matches []LogEntry
+	err := ScanLog(func(entry LogEntry) {
+		if len(matches) < 2 && prefix != "" && strings.HasPrefix(entry.ID, prefix) {
+			matches = append(matches, entry)
+		}
+	})
+	if err != nil {
+		return LogEntry{}, err
+	}
+
+	idx, err := FindLogEntry(matches, prefix)
+	if err != nil {
+		return LogEntry{}, err
+	}
+	return matches[idx], nil
+}
+
+// ShowLog prints the response of the log entry whose ID starts with prefix
+func ShowLog(prefix string) error {
+	entry, err := LookupLogEntry(prefix)
+	if err != nil {
+		return err
+	}
+
+	printLogEntry(entry, true)
 	return nil
 }
 
-// WriteLogEntry writes a single log entry to the JSONL file
+// WriteLogEntry writes a single log entry to the JSONL file, rotating it
+// first if it's due. Entries are written one at a time by the log writer, so
+// it's safe to call from any goroutine, and returns once it's written
 func WriteLogEntry(entry LogEntry) error {
+	if entry.ID == "" {
+		entry.ID = uuid.NewString()
+	}
+
 	// Convert entry to JSON
 	jsonData, err := json.Marshal(entry)
 	if err != nil {
@@ -137,17 +345,12 @@ func WriteLogEntry(entry LogEntry) error {
 		return err
 	}
 
-	// Open file in append mode, create if doesn't exist
-	file, err := os.OpenFile(logFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to open log file: %w", err)
-	}
-	defer file.Close()
-
-	// Write JSON line with newline
-	if _, err := file.Write(append(jsonData, '\n')); err != nil {
-		return fmt.Errorf("failed to write to log file: %w", err)
-	}
+	startLogWriter.Do(func() {
+		logWrites = make(chan logWrite)
+		go runLogWriter()
+	})
 
-	return nil
+	done := make(chan error, 1)
+	logWrites <- logWrite{path: logFilePath, line: append(jsonData, '\n'), done: done}
+	return <-done
 }
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+)
+
+// readLogEntries reads every entry in the log, newest first, with entries
+// written at the same time in the reverse of the order they were written
+func readLogEntries(t *testing.T) []LogEntry {
+	t.Helper()
+
+	var entries []LogEntry
+	if err := ScanLog(func(entry LogEntry) { entries = append(entries, entry) }); err != nil {
+		t.Fatal(err)
+	}
+
+	slices.Reverse(entries)
+	sort.SliceStable(entries, func(i int, j int) bool {
+		return entries[i].Timestamp.After(entries[j].Timestamp)
+	})
+	return entries
+}
+
+func TestLogEntryIDs(t *testing.T) {
+	logPath = filepath.Join(t.TempDir(), "gollm_logs.jsonl")
+	t.Cleanup(func() { logPath = "" })
+
+	// An entry from before IDs, then two written in the same second
+	legacy := `{"model_name":"old","prompt_text":"Before","timestamp":"2025-01-01T00:00:00Z"}` + "\n"
+	if err := os.WriteFile(logPath, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Truncate(time.Second)
+	for _, prompt := range []string{"First", "Second"} {
+		if err := WriteLogEntry(LogEntry{PromptText: prompt, Timestamp: now}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries := readLogEntries(t)
+	if len(entries) != 3 || entries[0].PromptText != "Second" || entries[2].PromptText != "Before" {
+		t.Fatalf("Expected the newest first, got %+v", entries)
+	}
+	if entries[0].ID == "" || entries[0].ID == entries[1].ID {
+		t.Errorf("Expected unique IDs, got %q and %q", entries[0].ID, entries[1].ID)
+	}
+
+	again := readLogEntries(t)
+	if entries[2].ID == "" || again[2].ID != entries[2].ID {
+		t.Errorf("Expected the legacy entry's ID to be the same each time, got %q and %q", entries[2].ID, again[2].ID)
+	}
+
+	idx, err := FindLogEntry(entries, shortID(entries[1].ID))
+	if err != nil || idx != 1 {
+		t.Errorf("Expected to find the entry by its short ID, got %d (%v)", idx, err)
+	}
+}
+
+func TestFindLogEntryErrors(t *testing.T) {
+	entries := []LogEntry{{ID: "abc-1"}, {ID: "abd-2"}}
+
+	if _, err := FindLogEntry(entries, "ab"); err == nil {
+		t.Error("Expected an error for an ambiguous prefix")
+	}
+	if _, err := FindLogEntry(entries, "xyz"); err == nil {
+		t.Error("Expected an error for a missing entry")
+	}
+	if _, err := FindLogEntry(entries, ""); err == nil {
+		t.Error("Expected an error for no ID")
+	}
+}
+
+func TestLookupLogEntry(t *testing.T) {
+	logPath = filepath.Join(t.TempDir(), "gollm_logs.jsonl")
+	t.Cleanup(func() { logPath = "" })
+
+	for _, id := range []string{"abc-1", "abd-2", "abe-3"} {
+		if err := WriteLogEntry(LogEntry{ID: id, PromptText: id, Timestamp: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entry, err := LookupLogEntry("abd")
+	if err != nil || entry.PromptText != "abd-2" {
+		t.Errorf("Expected abd-2, got %+v (%v)", entry, err)
+	}
+	if _, err := LookupLogEntry("ab"); err == nil {
+		t.Error("Expected an error for an ambiguous prefix")
+	}
+	if _, err := LookupLogEntry("xyz"); err == nil {
+		t.Error("Expected an error for a missing entry")
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogConfig is how the log is rotated and how long the rotated files, the
+// segments, are kept. The zero value never rotates
+type LogConfig struct {
+	// Rotate starts a new log file each "daily" or "monthly", local time
+	Rotate string `toml:"rotate,omitempty"`
+	// RotateSizeMB starts a new log file when it reaches this size
+	RotateSizeMB int `toml:"rotate_size_mb,omitempty"`
+	// Compress gzips the segments
+	Compress bool `toml:"compress"`
+	// MaxAgeDays deletes segments last written longer ago than this, and
+	// MaxTotalMB the oldest segments while the log is bigger than this
+	MaxAgeDays int `toml:"max_age_days,omitempty"`
+	MaxTotalMB int `toml:"max_total_mb,omitempty"`
+}
+
+// logRotation is set by main from the config
+var logRotation LogConfig
+
+// Validate checks the rotation and limits make sense
+func (c LogConfig) Validate() error {
+	if c.Rotate != "" && c.Rotate != "daily" && c.Rotate != "monthly" {
+		return fmt.Errorf("log.rotate should be daily or monthly, not %q", c.Rotate)
+	}
+	if c.RotateSizeMB < 0 || c.MaxAgeDays < 0 || c.MaxTotalMB < 0 {
+		return fmt.Errorf("log sizes and ages can't be negative")
+	}
+	return nil
+}
+
+// period is the day or month t is in, for when Rotate is set
+func (c LogConfig) period(t time.Time) string {
+	if c.Rotate == "daily" {
+		return t.Local().Format("2006-01-02")
+	}
+	return t.Local().Format("2006-01")
+}
+
+// logSegmentTime is how the time of a segment's first entry is written in
+// its name
+const logSegmentTime = "20060102-150405"
+
+// logSegment is a rotated log file, whose first entry was at start
+type logSegment struct {
+	path  string
+	start time.Time
+	// n tells apart segments started in the same second
+	n int
+}
+
+// logSegmentPattern matches the name of a segment of the log whose file
+// name has stem and ext, e.g. gollm_logs-20250501-093000.jsonl.gz
+func logSegmentPattern(stem string, ext string) *regexp.Regexp {
+	return regexp.MustCompile(`^` + regexp.QuoteMeta(stem) + `-(\d{8}-\d{6})(-\d+)?` + regexp.QuoteMeta(ext) + `(\.gz)?$`)
+}
+
+// splitLogPath splits the log's path into its directory, the file's name
+// without the extension and the extension
+func splitLogPath(path string) (string, string, string) {
+	dir, name := filepath.Split(path)
+	ext := filepath.Ext(name)
+	return dir, strings.TrimSuffix(name, ext), ext
+}
+
+// logSegments returns the segments of the log at path, oldest first
+func logSegments(path string) ([]logSegment, error) {
+	dir, stem, ext := splitLogPath(path)
+	if dir == "" {
+		dir = "."
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	pattern := logSegmentPattern(stem, ext)
+	var segments []logSegment
+	for _, file := range files {
+		match := pattern.FindStringSubmatch(file.Name())
+		if match == nil || file.IsDir() {
+			continue
+		}
+		start, err := time.Parse(logSegmentTime, match[1])
+		if err != nil {
+			continue
+		}
+		n, _ := strconv.Atoi(strings.TrimPrefix(match[2], "-"))
+		segments = append(segments, logSegment{path: filepath.Join(dir, file.Name()), start: start, n: n})
+	}
+
+	sort.Slice(segments, func(i int, j int) bool {
+		if !segments[i].start.Equal(segments[j].start) {
+			return segments[i].start.Before(segments[j].start)
+		}
+		return segments[i].n < segments[j].n
+	})
+	return segments, nil
+}
+
+// logFiles returns the files of the log at path which may hold entries from
+// since on, oldest first: the segments and then the file being written
+func logFiles(path string, since time.Time) ([]string, error) {
+	segments, err := logSegments(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	// Entries are logged once the call's done, so each segment's are from
+	// before it was last written to
+	var files []string
+	for _, segment := range segments {
+		if info, err := os.Stat(segment.path); err == nil && info.ModTime().Before(since) {
+			continue
+		}
+		files = append(files, segment.path)
+	}
+	return append(files, path), nil
+}
+
+// openLogFile opens a file of the log for reading, decompressing it if it's
+// a gzipped segment
+func openLogFile(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return file, nil
+	}
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to decompress %s: %w", path, err)
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{reader, file}, nil
+}
+
+// firstEntryTime returns the timestamp of the first entry in the file at
+// path, or the time it was last written if that can't be read
+func firstEntryTime(path string, info fs.FileInfo) time.Time {
+	file, err := os.Open(path)
+	if err != nil {
+		return info.ModTime()
+	}
+	defer file.Close()
+
+	reader := bufio.NewReaderSize(file, 64*1024)
+	line, err := reader.ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		return info.ModTime()
+	}
+
+	var entry LogEntry
+	if json.Unmarshal(line, &entry) != nil || entry.Timestamp.IsZero() {
+		return info.ModTime()
+	}
+	return entry.Timestamp
+}
+
+// rotateLogIfDue rotates the log at path if it's reached the size limit, or
+// its first entry is from an earlier day or month than now
+func rotateLogIfDue(path string, now time.Time) error {
+	if logRotation.Rotate == "" && logRotation.RotateSizeMB == 0 {
+		return nil
+	}
+
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return nil
+	}
+
+	start := firstEntryTime(path, info)
+	due := logRotation.RotateSizeMB > 0 && info.Size() >= int64(logRotation.RotateSizeMB)*1024*1024
+	if logRotation.Rotate != "" && logRotation.period(start) != logRotation.period(now) {
+		due = true
+	}
+	if !due {
+		return nil
+	}
+
+	return rotateLog(path, start, now)
+}
+
+// rotateLog moves the log at path, whose first entry is at start, to a new
+// segment, compresses it if asked and then applies the retention policy
+func rotateLog(path string, start time.Time, now time.Time) error {
+	dir, stem, ext := splitLogPath(path)
+	segment := filepath.Join(dir, stem+"-"+start.UTC().Format(logSegmentTime)+ext)
+	for n := 1; segmentExists(segment); n++ {
+		segment = filepath.Join(dir, fmt.Sprintf("%s-%s-%d%s", stem, start.UTC().Format(logSegmentTime), n, ext))
+	}
+
+	if err := os.Rename(path, segment); err != nil {
+		return fmt.Errorf("failed to rotate the log: %w", err)
+	}
+
+	if logRotation.Compress {
+		if err := gzipFile(segment); err != nil {
+			return err
+		}
+	}
+
+	return applyLogRetention(path, now)
+}
+
+// segmentExists is true if there's a segment at path, compressed or not
+func segmentExists(path string) bool {
+	for _, each := range []string{path, path + ".gz"} {
+		if _, err := os.Stat(each); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipFile compresses the file at path to path.gz, keeping its time, and
+// removes it
+func gzipFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to compress the log: %w", err)
+	}
+
+	writer := gzip.NewWriter(dst)
+	_, err = io.Copy(writer, src)
+	if err == nil {
+		err = writer.Close()
+	}
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return fmt.Errorf("failed to compress the log: %w", err)
+	}
+
+	// The segment's time is when it was last written to, for MaxAgeDays
+	if err := os.Chtimes(path+".gz", info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// applyLogRetention deletes the segments of the log at path which are too
+// old, and then the oldest while the log is too big
+func applyLogRetention(path string, now time.Time) error {
+	if logRotation.MaxAgeDays == 0 && logRotation.MaxTotalMB == 0 {
+		return nil
+	}
+
+	segments, err := logSegments(path)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	if info, err := os.Stat(path); err == nil {
+		total = info.Size()
+	}
+	sizes := make([]int64, len(segments))
+	times := make([]time.Time, len(segments))
+	for i, segment := range segments {
+		info, err := os.Stat(segment.path)
+		if err != nil {
+			return err
+		}
+		sizes[i], times[i] = info.Size(), info.ModTime()
+		total += sizes[i]
+	}
+
+	maxAge := now.AddDate(0, 0, -logRotation.MaxAgeDays)
+	maxTotal := int64(logRotation.MaxTotalMB) * 1024 * 1024
+	for i, segment := range segments {
+		tooOld := logRotation.MaxAgeDays > 0 && times[i].Before(maxAge)
+		tooBig := logRotation.MaxTotalMB > 0 && total > maxTotal
+		if !tooOld && !tooBig {
+			continue
+		}
+		if err := os.Remove(segment.path); err != nil {
+			return fmt.Errorf("failed to delete old log %s: %w", segment.path, err)
+		}
+		total -= sizes[i]
+	}
+	return nil
+}
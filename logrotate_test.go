@@ -0,0 +1,178 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// useLogRotation points the log at a temporary directory, rotating as
+// config says, for the length of the test
+func useLogRotation(t *testing.T, config LogConfig) string {
+	dir := t.TempDir()
+	logPath = filepath.Join(dir, "gollm_logs.jsonl")
+	logRotation = config
+	t.Cleanup(func() {
+		logPath = ""
+		logRotation = LogConfig{}
+	})
+	return dir
+}
+
+func TestLogRotatesMonthly(t *testing.T) {
+	dir := useLogRotation(t, LogConfig{Rotate: "monthly", Compress: true})
+
+	// An entry from before IDs, in an earlier month
+	legacy := `{"model_name":"old","prompt_text":"Before","timestamp":"2025-01-01T12:00:00Z"}` + "\n"
+	if err := os.WriteFile(logPath, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+	january := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(logPath, january, january); err != nil {
+		t.Fatal(err)
+	}
+	before := readLogEntries(t)
+
+	for _, prompt := range []string{"First", "Second"} {
+		if err := WriteLogEntry(LogEntry{PromptText: prompt, Timestamp: time.Now()}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	segments, err := logSegments(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 1 || filepath.Base(segments[0].path) != "gollm_logs-20250101-120000.jsonl.gz" {
+		t.Fatalf("Expected one compressed segment for January, got %+v", segments)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "gollm_logs-20250101-120000.jsonl")); err == nil {
+		t.Error("Expected the uncompressed segment to be removed")
+	}
+
+	entries := readLogEntries(t)
+	if len(entries) != 3 || entries[0].PromptText != "Second" || entries[2].PromptText != "Before" {
+		t.Fatalf("Expected the entries across segments, newest first, got %+v", entries)
+	}
+	if entries[2].ID != before[0].ID {
+		t.Errorf("Expected the legacy entry to keep its ID once compressed, got %q and %q", before[0].ID, entries[2].ID)
+	}
+
+	// The January segment isn't read for entries since yesterday
+	var count int
+	if err := ScanLogSince(time.Now().AddDate(0, 0, -1), func(LogEntry) { count++ }); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("Expected the segment to be skipped, got %d entries", count)
+	}
+}
+
+func TestLogRotatesBySize(t *testing.T) {
+	useLogRotation(t, LogConfig{RotateSizeMB: 1})
+
+	now := time.Date(2025, 5, 1, 9, 30, 0, 0, time.UTC)
+	big := LogEntry{PromptText: strings.Repeat("x", 1024*1024), Timestamp: now}
+	for range 2 {
+		if err := WriteLogEntry(big); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := WriteLogEntry(LogEntry{PromptText: "Small", Timestamp: now}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two segments started at the same second are numbered apart
+	segments, err := logSegments(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segments) != 2 || filepath.Base(segments[1].path) != "gollm_logs-20250501-093000-1.jsonl" {
+		t.Fatalf("Expected two uncompressed segments, got %+v", segments)
+	}
+
+	var prompts []string
+	if err := ScanLog(func(entry LogEntry) { prompts = append(prompts, entry.PromptText[:min(len(entry.PromptText), 5)]) }); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(prompts, ",") != "xxxxx,xxxxx,Small" {
+		t.Errorf("Expected the entries in order, got %v", prompts)
+	}
+}
+
+func TestLogRetention(t *testing.T) {
+	dir := useLogRotation(t, LogConfig{Rotate: "daily", MaxAgeDays: 30, MaxTotalMB: 1})
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	segment := func(name string, size int, written time.Time) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, written, written); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	old := segment("gollm_logs-20250401-000000.jsonl.gz", 10, now.AddDate(0, 0, -40))
+	big := segment("gollm_logs-20250510-000000.jsonl.gz", 700*1024, now.AddDate(0, 0, -20))
+	recent := segment("gollm_logs-20250520-000000.jsonl.gz", 500*1024, now.AddDate(0, 0, -10))
+	other := segment("other-20250401-000000.jsonl", 10, now.AddDate(0, 0, -40))
+
+	if err := applyLogRetention(logPath, now); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, kept := range map[string]bool{old: false, big: false, recent: true, other: true} {
+		if _, err := os.Stat(path); (err == nil) != kept {
+			t.Errorf("Expected %s kept to be %v, got %v", filepath.Base(path), kept, err)
+		}
+	}
+}
+
+func TestLogConfigValidate(t *testing.T) {
+	if err := (LogConfig{Rotate: "monthly", MaxAgeDays: 90}).Validate(); err != nil {
+		t.Errorf("Expected a monthly rotation to be valid, got %v", err)
+	}
+	if err := (LogConfig{Rotate: "weekly"}).Validate(); err == nil {
+		t.Error("Expected an error for a weekly rotation")
+	}
+	if err := (LogConfig{MaxTotalMB: -1}).Validate(); err == nil {
+		t.Error("Expected an error for a negative size")
+	}
+}
+
+func TestScanLogWhileRotating(t *testing.T) {
+	useLogRotation(t, LogConfig{RotateSizeMB: 1})
+
+	now := time.Date(2025, 5, 1, 9, 30, 0, 0, time.UTC)
+	big := LogEntry{PromptText: strings.Repeat("x", 1024*1024), Timestamp: now}
+	for _, entry := range []LogEntry{big, {PromptText: "Small", Timestamp: now}} {
+		if err := WriteLogEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Another process rotates the log while the first segment's read, taking
+	// "Small" into a segment which wasn't there when the log was listed
+	var prompts []string
+	err := ScanLog(func(entry LogEntry) {
+		prompts = append(prompts, entry.PromptText[:min(len(entry.PromptText), 5)])
+		if len(prompts) > 1 {
+			return
+		}
+		for _, entry := range []LogEntry{big, {PromptText: "After", Timestamp: now}} {
+			if err := WriteLogEntry(entry); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(prompts, ",") != "xxxxx,Small,xxxxx" {
+		t.Errorf("Expected the entries as they were when the scan began, got %v", prompts)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LogProblem is a line of the log which isn't an entry, most likely from
+// writes which were cut short or ran into each other
+type LogProblem struct {
+	Path string
+	Line int
+	Err  error
+	// Recovered is how many whole entries the line starts with, such as
+	// when one write ran into another
+	Recovered int
+}
+
+// LogVerification is what verifying the log found
+type LogVerification struct {
+	Files    int
+	Entries  int
+	Problems []LogProblem
+	// CorruptPath is where the corrupt lines went, if any were repaired
+	CorruptPath string
+}
+
+// VerifyLog checks every line of the log and its segments is an entry. With
+// repair, it rewrites the files which have corrupt lines, keeping the whole
+// entries the lines start with and putting the rest in path.corrupt. The
+// log is locked throughout, so it isn't rotated meanwhile, and nothing is
+// written while it's repaired
+func VerifyLog(repair bool) (LogVerification, error) {
+	logFilePath, err := getLogPath()
+	if err != nil {
+		return LogVerification{}, err
+	}
+
+	withLock := withSharedLogLock
+	if repair {
+		withLock = withLogLock
+	}
+
+	var result LogVerification
+	err = withLock(logFilePath, func() error {
+		result, err = verifyLogFiles(logFilePath, repair)
+		return err
+	})
+	return result, err
+}
+
+// verifyLogFiles verifies, and maybe repairs, each file of the log at path
+func verifyLogFiles(path string, repair bool) (LogVerification, error) {
+	var result LogVerification
+
+	files, err := logFiles(path, time.Time{})
+	if err != nil {
+		return result, err
+	}
+
+	for _, file := range files {
+		kept, corrupt, err := verifyLogFile(file, &result)
+		if errors.Is(err, fs.ErrNotExist) && len(files) > 1 {
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		result.Files++
+
+		if !repair || len(corrupt) == 0 {
+			continue
+		}
+		result.CorruptPath = path + ".corrupt"
+		if err := appendFile(result.CorruptPath, corrupt); err != nil {
+			return result, fmt.Errorf("failed to save the corrupt lines: %w", err)
+		}
+		if err := rewriteLogFile(file, kept); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// verifyLogFile checks each line of the file at path, adding the entries
+// and problems to result. It returns the file as it should be, with only
+// whole entries, and the corrupt lines taken out
+func verifyLogFile(path string, result *LogVerification) ([]byte, []byte, error) {
+	file, err := openLogFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	var kept, corrupt bytes.Buffer
+	// Lines are read whole, however long, where the log's reader gives up
+	// past maxLogLine
+	reader := bufio.NewReader(file)
+	lineNo := 0
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, nil, fmt.Errorf("error reading file %s: %w", path, err)
+		}
+		if len(line) == 0 {
+			return kept.Bytes(), corrupt.Bytes(), nil
+		}
+		lineNo++
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		entries, rest, err := checkLogLine(line)
+		result.Entries += len(entries)
+		for _, entry := range entries {
+			kept.Write(entry)
+			kept.WriteByte('\n')
+		}
+		if err == nil {
+			continue
+		}
+
+		result.Problems = append(result.Problems, LogProblem{Path: path, Line: lineNo, Err: err, Recovered: len(entries)})
+		corrupt.Write(rest)
+		corrupt.WriteByte('\n')
+	}
+}
+
+// checkLogLine is splitLogLine for a line of any length. One too long for
+// the log's reader is corrupt as a whole, as it would stop it reading on
+func checkLogLine(line []byte) ([][]byte, []byte, error) {
+	line = bytes.TrimSpace(line)
+	if len(line) > maxLogLine {
+		return nil, line, fmt.Errorf("line is longer than the %d MB the log is read with", maxLogLine/(1024*1024))
+	}
+	return splitLogLine(line)
+}
+
+// splitLogLine splits line into the entries it starts with, which is one
+// for a good line, and what's left if it isn't all entries, with why not
+func splitLogLine(line []byte) ([][]byte, []byte, error) {
+	var entries [][]byte
+	decoder := json.NewDecoder(bytes.NewReader(line))
+
+	for {
+		start := decoder.InputOffset()
+		var raw json.RawMessage
+		err := decoder.Decode(&raw)
+		if err == io.EOF {
+			return entries, nil, nil
+		}
+
+		// Anything but an object, even null, would unmarshal to an empty entry
+		var entry LogEntry
+		if err == nil && !bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{")) {
+			err = fmt.Errorf("%.20s isn't an entry", bytes.TrimSpace(raw))
+		}
+		if err == nil {
+			err = json.Unmarshal(raw, &entry)
+		}
+		if err != nil {
+			return entries, bytes.TrimSpace(line[start:]), err
+		}
+		entries = append(entries, bytes.TrimSpace(raw))
+	}
+}
+
+// appendFile appends data to the file at path, creating it if need be
+func appendFile(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// rewriteLogFile replaces the file at path with data, compressed if it's a
+// gzipped segment, keeping its time. The new file is written beside it and
+// renamed over it, so it's never left half written
+func rewriteLogFile(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), ".gollm-repair-*")
+	if err != nil {
+		return fmt.Errorf("failed to repair %s: %w", path, err)
+	}
+	defer os.Remove(temp.Name())
+
+	var writer io.Writer = temp
+	var zipper *gzip.Writer
+	if filepath.Ext(path) == ".gz" {
+		zipper = gzip.NewWriter(temp)
+		writer = zipper
+	}
+
+	_, err = writer.Write(data)
+	if err == nil && zipper != nil {
+		err = zipper.Close()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to repair %s: %w", path, err)
+	}
+
+	if err := os.Chmod(temp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := os.Chtimes(temp.Name(), info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return fmt.Errorf("failed to repair %s: %w", path, err)
+	}
+	return nil
+}
+
+// cmdLogVerify checks the log for corrupt lines, and with --repair takes
+// them out
+func cmdLogVerify(args []string) error {
+	fs := flag.NewFlagSet("log verify", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	repair := fs.Bool("repair", false, "take the corrupt lines out of the log, keeping any whole entries in them")
+
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("unexpected %q, see %s help", positional[0], os.Args[0])
+	}
+
+	result, err := VerifyLog(*repair)
+	if err != nil {
+		return err
+	}
+
+	for _, problem := range result.Problems {
+		recovered := ""
+		if problem.Recovered > 0 {
+			recovered = fmt.Sprintf(", after %d whole entries", problem.Recovered)
+		}
+		fmt.Printf("%s line %d: %v%s\n", problem.Path, problem.Line, problem.Err, recovered)
+	}
+
+	lines := "lines"
+	if len(result.Problems) == 1 {
+		lines = "line"
+	}
+	fmt.Printf("Checked %d entries in %d files, %d corrupt %s\n", result.Entries, result.Files, len(result.Problems), lines)
+
+	switch {
+	case len(result.Problems) == 0:
+		return nil
+	case *repair:
+		fmt.Printf("Repaired, with the corrupt lines saved to %s\n", result.CorruptPath)
+		return nil
+	default:
+		return fmt.Errorf("the log has corrupt lines, see %s log verify --repair", os.Args[0])
+	}
+}
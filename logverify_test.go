@@ -0,0 +1,131 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrentLogWrites(t *testing.T) {
+	logPath = filepath.Join(t.TempDir(), "gollm_logs.jsonl")
+	t.Cleanup(func() { logPath = "" })
+
+	// A line cut short by an earlier crash
+	if err := os.WriteFile(logPath, []byte(`{"prompt_text":"Cut`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			entry := LogEntry{PromptText: fmt.Sprint(i), ModelResponse: strings.Repeat("x", 256*1024), Timestamp: time.Now()}
+			if err := WriteLogEntry(entry); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	result, err := VerifyLog(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Entries != 20 || len(result.Problems) != 1 || result.Problems[0].Line != 1 {
+		t.Errorf("Expected 20 whole entries after the cut line, got %d and %+v", result.Entries, result.Problems)
+	}
+}
+
+func TestVerifyLogRepair(t *testing.T) {
+	dir := t.TempDir()
+	logPath = filepath.Join(dir, "gollm_logs.jsonl")
+	t.Cleanup(func() { logPath = "" })
+
+	good := `{"model_name":"old","prompt_text":"Before","timestamp":"2025-01-01T00:00:00Z"}`
+	glued := `{"prompt_text":"One","timestamp":"2025-02-01T00:00:00Z"}{"prompt_text":"Two","timestamp":"2025-02-01T00:00:01Z"}{"prompt_te`
+	torn := `{"prompt_text":"Three","respon`
+	if err := os.WriteFile(logPath, []byte(good+"\n"+glued+"\n"+torn+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A compressed segment with a torn line too
+	segmentPath := filepath.Join(dir, "gollm_logs-20241201-000000.jsonl.gz")
+	file, err := os.Create(segmentPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zipper := gzip.NewWriter(file)
+	fmt.Fprintln(zipper, `{"prompt_text":"December","timestamp":"2024-12-01T00:00:00Z"}`)
+	fmt.Fprintln(zipper, `{"prompt_text":"Dec`)
+	zipper.Close()
+	file.Close()
+
+	before := readLogEntries(t)
+
+	result, err := VerifyLog(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Files != 2 || len(result.Problems) != 3 || result.Problems[1].Recovered != 2 {
+		t.Fatalf("Expected three corrupt lines in two files, got %+v", result)
+	}
+
+	if _, err := VerifyLog(true); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err = VerifyLog(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Problems) != 0 || result.Entries != 4 {
+		t.Errorf("Expected four entries and no problems once repaired, got %+v", result)
+	}
+
+	after := readLogEntries(t)
+	if len(after) != 4 || after[0].PromptText != "Two" || after[3].PromptText != "December" {
+		t.Fatalf("Expected the whole entries kept, got %+v", after)
+	}
+	if after[2].ID != before[len(before)-2].ID {
+		t.Errorf("Expected the good entry to keep its ID, got %q and %q", before[len(before)-2].ID, after[2].ID)
+	}
+
+	corrupt, err := os.ReadFile(logPath + ".corrupt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(corrupt), "\n") != 3 || !strings.Contains(string(corrupt), `{"prompt_te`) {
+		t.Errorf("Expected the corrupt lines saved, got %q", corrupt)
+	}
+}
+
+func TestVerifyLogOddLines(t *testing.T) {
+	logPath = filepath.Join(t.TempDir(), "gollm_logs.jsonl")
+	t.Cleanup(func() { logPath = "" })
+
+	long := `{"prompt_text":"` + strings.Repeat("x", maxLogLine) + `"}`
+	lines := []string{`{"prompt_text":"First"}`, "null", `[1, 2]`, long, `"text"`, `{"prompt_text":"Last"}`}
+	if err := os.WriteFile(logPath, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := VerifyLog(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Entries != 2 || len(result.Problems) != 4 || result.Problems[2].Line != 4 {
+		t.Fatalf("Expected everything but the two entries to be corrupt, got %d entries and %v", result.Entries, result.Problems)
+	}
+
+	// Once the long line's out of the way the log can be read
+	entries := readLogEntries(t)
+	if len(entries) != 2 || entries[0].PromptText != "Last" {
+		t.Errorf("Expected the two entries left, got %+v", entries)
+	}
+}
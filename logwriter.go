@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// logWrite is a line to append to the log at path, and where to say how it
+// went
+type logWrite struct {
+	path string
+	line []byte
+	done chan<- error
+}
+
+var (
+	// logWrites are written in turn by the one log writer, which is started
+	// by the first write
+	logWrites      chan logWrite
+	startLogWriter sync.Once
+)
+
+// runLogWriter writes each line sent to logWrites
+func runLogWriter() {
+	for write := range logWrites {
+		write.done <- withLogLock(write.path, func() error {
+			return appendLogLine(write.path, write.line)
+		})
+	}
+}
+
+// withLogLock runs fn holding the lock on the log at path, which other
+// gollm processes take to write to or rotate the log too. The lock is on a
+// file of its own, path.lock, as the log itself is renamed when rotated
+func withLogLock(path string, fn func() error) error {
+	lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open the log's lock: %w", err)
+	}
+	defer lock.Close()
+
+	if err := lockFile(lock); err != nil {
+		return fmt.Errorf("failed to lock the log: %w", err)
+	}
+	defer unlockFile(lock)
+
+	return fn()
+}
+
+// withSharedLogLock runs fn holding a shared lock on the log at path, so
+// it can't be written to or rotated meanwhile but others can read it too.
+// Where the lock can't be opened, say as the log's directory isn't there or
+// is someone else's, fn runs without it
+func withSharedLogLock(path string, fn func() error) error {
+	lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return fn()
+	}
+	defer lock.Close()
+
+	if err := lockFileShared(lock); err != nil {
+		return fmt.Errorf("failed to lock the log: %w", err)
+	}
+	defer unlockFile(lock)
+
+	return fn()
+}
+
+// appendLogLine appends line, which ends in a newline, to the log at path
+// in a single write, rotating the log first if it's due
+func appendLogLine(path string, line []byte) error {
+	// The entry's still written to the old file if rotating fails
+	if err := rotateLogIfDue(path, time.Now()); err != nil {
+		fmt.Fprintf(os.Stderr, "Couldn't rotate the log: %v\n", err)
+	}
+
+	// Open file in append mode, create if doesn't exist
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer file.Close()
+
+	// A write cut short, say by a crash, leaves a line without its newline,
+	// which shouldn't take this entry down with it
+	if torn, err := endsTorn(file); err != nil {
+		return fmt.Errorf("failed to read log file: %w", err)
+	} else if torn {
+		line = append([]byte{'\n'}, line...)
+	}
+
+	if _, err := file.Write(line); err != nil {
+		return fmt.Errorf("failed to write to log file: %w", err)
+	}
+	return nil
+}
+
+// endsTorn is true if file isn't empty and doesn't end in a newline
+func endsTorn(file *os.File) (bool, error) {
+	info, err := file.Stat()
+	if err != nil || info.Size() == 0 {
+		return false, err
+	}
+
+	last := make([]byte, 1)
+	if _, err := file.ReadAt(last, info.Size()-1); err != nil && err != io.EOF {
+		return false, err
+	}
+	return last[0] != '\n', nil
+}
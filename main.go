@@ -1,14 +1,12 @@
 package main
 
 import (
-	"bufio"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
-	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/charmbracelet/glamour"
@@ -16,19 +14,23 @@ import (
 
 // Types etc
 type ModelResponse struct {
-	Model        string
-	TotalTokens  int
-	Citations    []string
-	Content      string
-	FinishReason string
+	Model       string
+	TotalTokens int
+	// CachedTokens are part of PromptTokens, and ReasoningTokens of
+	// CompletionTokens; all are 0 if the provider didn't say
+	PromptTokens     int
+	CompletionTokens int
+	CachedTokens     int
+	ReasoningTokens  int
+	Citations        []string
+	Content          string
+	FinishReason     string
+	SafetyRating     string
+	// Images and RelatedQuestions are only returned by Perplexity when asked for
+	Images           []string
+	RelatedQuestions []string
 }
 
-// Globals with various environment variable names for API keys
-const perplexityApiKey = "PERPLEXITY_API_KEY"
-const geminiApiKey = "GEMINI_API_KEY"
-const chatGPTApiKey = "OPENAI_API_KEY"
-const cerebrasApiKey = "CEREBRAS_API_KEY"
-
 // if quiet mode is enabled:
 // - we turn off logging
 // - we can use raw print not glamour
@@ -86,6 +88,17 @@ func Render(s string) {
 	}
 }
 
+// splitList splits a comma separated list, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, each := range strings.Split(value, ",") {
+		if each = strings.TrimSpace(each); each != "" {
+			items = append(items, each)
+		}
+	}
+	return items
+}
+
 func strSliceContains(s []string, str string) bool {
 	for _, v := range s {
 		if v == str {
@@ -100,62 +113,26 @@ func Fatalf(format string, a ...any) {
 	os.Exit(1)
 }
 
-func getPerplexityAPIKey() string {
-	return os.Getenv(perplexityApiKey)
-}
-
-func getGeminiAPIKey() string {
-	return os.Getenv(geminiApiKey)
-}
-
-func getChatGPTAPIKey() string {
-	return os.Getenv(chatGPTApiKey)
-}
-
-func getCerebrasAPIKey() string {
-	return os.Getenv(cerebrasApiKey)
-}
-
-func GetPerplexityAPIKeyOrBail() string {
-	ret := getPerplexityAPIKey()
-	if ret == "" {
-		Fatalf("%s is not set", perplexityApiKey)
-	}
-	return ret
-}
-
-func GetGeminiAPIKeyOrBail() string {
-	ret := getGeminiAPIKey()
-	if ret == "" {
-		Fatalf("%s is not set", geminiApiKey)
-	}
-	return ret
-}
-
-func GetChatGPTAPIKeyOrBail() string {
-	ret := getChatGPTAPIKey()
-	if ret == "" {
-		Fatalf("%s is not set", chatGPTApiKey)
+func PrintAPIKeys() {
+	fmt.Println()
+	for _, p := range Providers() {
+		if p.EnvKey() != "" {
+			fmt.Printf("%s API key is: %+v\n", p.Name(), GetAPIKey(p))
+		}
 	}
-	return ret
 }
 
-func GetCerebrasAPIKeyOrBail() string {
-	ret := getCerebrasAPIKey()
-	if ret == "" {
-		Fatalf("%s is not set", cerebrasApiKey)
-	}
-	return ret
-}
-
-func PrintAPIKeys() {
-	fmtStr := "\nPerplexity API key is: %+v\nChatGPT API key is: %+v\nGemini API key is: %+v\n"
-	fmt.Printf(fmtStr, getPerplexityAPIKey(), getChatGPTAPIKey(), getGeminiAPIKey())
-}
+// renderStyle is the glamour style from the config, "" being auto
+var renderStyle string
 
 func RenderWithGlamour(text string) {
 	// Use Glamour for rendering                                                                                                                                // You can customize options like style (dark, light, notty), word wrap, etc.                                                                               // Default options:
-	renderer, err := glamour.NewTermRenderer(glamour.WithAutoStyle(), glamour.WithWordWrap(0))
+	style := glamour.WithAutoStyle()
+	if renderStyle != "" && renderStyle != "auto" {
+		// Either a standard style name or the path of a JSON style
+		style = glamour.WithStylePath(renderStyle)
+	}
+	renderer, err := glamour.NewTermRenderer(style, glamour.WithWordWrap(0))
 
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error creating renderer: %v\n", err)
@@ -172,264 +149,112 @@ func RenderWithGlamour(text string) {
 }
 
 func PrintUsage(connectedToInternet bool) {
-	usageFmt := `%s [options] [model]
-
-	options:
-	-h	show (this) help
-	-lg	list Gemini models
-	-t	test API keys (note: they will be displayed)
-	-l	enable logging of model interactions to ~/gollm_logs.jsonl
-	-q	quiet mode: turns off logging and all non-essential output
-	-rl	[index]	show the log index, or if an index is provided, show the LLM response
-
-	model:
-	-c	use ChatGPT
-	-g	use Gemini
-	-f	use Cerebras
-	-p	use Perplexity
-
-	API keys should be set using the environment variables below:
-
-	# For Perplexity
-	export %s="your Perplexity API key here"
-
-	# For ChatGPT
-	export %s="your OpenAI API key here"
-
-	# For Gemini
-	export %s="your Gemini API key here"
-
-	# For Cerebras
-	export %s="your Cerebras API key here"
-
-`
-	apiKeyExtendo := "\t - You already have %s set\n"
-
-	haveGeminiAPIKey := getGeminiAPIKey() != ""
-	havePerplexityAPIKey := getPerplexityAPIKey() != ""
-	haveChatGPTAPIKey := getChatGPTAPIKey() != ""
-	haveCerebrasAPIKey := getCerebrasAPIKey() != ""
-
-	// If we have any of the keys
-	if haveGeminiAPIKey || havePerplexityAPIKey || haveChatGPTAPIKey || haveCerebrasAPIKey {
-		usageFmt += "\n\tSetup:\n"
-
-		if havePerplexityAPIKey {
-			usageFmt += fmt.Sprintf(apiKeyExtendo, perplexityApiKey)
-		}
+	var builder strings.Builder
 
-		if haveChatGPTAPIKey {
-			usageFmt += fmt.Sprintf(apiKeyExtendo, chatGPTApiKey)
-		}
-
-		if haveGeminiAPIKey {
-			usageFmt += fmt.Sprintf(apiKeyExtendo, geminiApiKey)
-		}
+	fmt.Fprintf(&builder, `%s [command] [options]
 
-		if haveCerebrasAPIKey {
-			usageFmt += fmt.Sprintf(apiKeyExtendo, cerebrasApiKey)
-		}
+	commands:
+`, os.Args[0])
 
+	for _, c := range Commands() {
+		fmt.Fprintf(&builder, "\t%s\t%s\n", strings.TrimSpace(c.Name+" "+c.Args), c.Summary)
 	}
-	// TODO: should we do something if impliedly we have none?
 
-	if connectedToInternet {
-		usageFmt += "\t - You are connected to the internet\n"
+	builder.WriteString("\n\task options:\n")
+	if fs, err := newAskFlags(&askOptions{}); err == nil {
+		builder.WriteString(usageFlags(fs))
 	}
 
-	if haveChatGPTAPIKey && haveGeminiAPIKey && havePerplexityAPIKey && haveCerebrasAPIKey && connectedToInternet {
-		usageFmt += "\t - We're ready to rumble :)\n"
-	}
+	builder.WriteString("\n\tlog list options:\n")
+	builder.WriteString(usageFlags(newLogListFlags(&logListOptions{}, time.Now())))
 
-	usageFmt += "\n"
-	usage := fmt.Sprintf(usageFmt, os.Args[0], perplexityApiKey, chatGPTApiKey, geminiApiKey, cerebrasApiKey)
-	fmt.Print(usage)
-}
+	builder.WriteString("\n\tlog stats options, besides the filters of log list:\n")
+	statsFlags := flag.NewFlagSet("log stats", flag.ContinueOnError)
+	addLogStatsFlags(statsFlags, &logStatsOptions{})
+	builder.WriteString(usageFlags(statsFlags))
 
-func main() {
-	useGemini, usePerplexity, useChatGPT, useCerebras := false, false, false, false
-	logToJsonl := false
-
-	// We do this here because we want the result in PrintUsage()
-	connected, err := CheckInternetHTTP()
-	argc := len(os.Args)
-
-	for idx, each := range os.Args {
-		if strings.Contains(each, "-rl") {
-			// negative means print all
-			var logIdx = -1
-			// TODO: should look ahead and see if the next argument can be an integer
-			// if it can be, that's our idx for ReadLogIdx
-
-			// if there is a next arg
-			if idx+1 < argc {
-				// try to atoi the next arg
-				intArg, err := strconv.Atoi(os.Args[idx+1])
-				// if successful use it
-				if err == nil {
-					logIdx = intArg
-				}
-			}
-
-			ReadLogIdx(logIdx)
-			os.Exit(0)
-		}
-
-		if strings.Contains(each, "-h") {
-			PrintUsage(connected)
-			os.Exit(0)
-		}
-
-		if strings.Contains(each, "-t") {
-			PrintAPIKeys()
-			os.Exit(0)
-		}
-
-		if strings.Contains(each, "-lg") {
-			fmt.Println(ListGeminiModels())
-			os.Exit(0)
-		}
-
-		if strings.Contains(each, "-lc") {
-			fmt.Println(ListOpenAIModels())
-			os.Exit(0)
-		}
-
-		if strings.Contains(each, "-q") {
-			quietMode = true
+	builder.WriteString("\n\tmodel:\n")
 
-			if logToJsonl {
-				logToJsonl = false
-				fmt.Fprintf(os.Stderr, "Not logging as quiet mode activated\n")
-			}
+	for _, p := range Providers() {
+		if p.Capabilities().Local {
+			fmt.Fprintf(&builder, "\t-%s\tuse %s (runs locally, only used when selected)\n", p.Flag(), p.Name())
+		} else {
+			fmt.Fprintf(&builder, "\t-%s\tuse %s\n", p.Flag(), p.Name())
 		}
+	}
 
-		if strings.Contains(each, "-l") {
-			if quietMode {
-				fmt.Fprintf(os.Stderr, "Not logging as quiet mode activated\n")
-			} else {
-				logToJsonl = true
-			}
-		}
+	builder.WriteString(`
+	The old options still work: -h is help, -t is keys, -rl [id] is log,
+	-l<model> e.g. -lg lists models, and anything else is passed to ask. A
+	prompt which starts like a command is asked if it doesn't fit the command,
+	and anything after -- is always asked.
+`)
 
-		if strings.Contains(each, "-c") {
-			useChatGPT = true
-			Print("Using ChatGPT")
-			break
-		}
+	builder.WriteString("\n\tAPI keys should be set using the environment variables below:\n\n")
 
-		if strings.Contains(each, "-g") {
-			useGemini = true
-			Print("Using Gemini")
-			break
+	for _, p := range Providers() {
+		if p.EnvKey() != "" {
+			fmt.Fprintf(&builder, "\t# For %s\n\texport %s=\"your %s API key here\"\n\n", p.Name(), p.EnvKey(), p.Name())
 		}
+	}
 
-		if strings.Contains(each, "-p") {
-			usePerplexity = true
-			Print("Using Perplexity")
-			break
+	// If we have any of the keys
+	haveAllKeys, haveAnyKeys := true, false
+	for _, p := range Providers() {
+		if p.EnvKey() == "" {
+			continue
 		}
-
-		if strings.Contains(each, "-f") {
-			useCerebras = true
-			Print("Using Cerebras")
-			break
+		if GetAPIKey(p) != "" {
+			haveAnyKeys = true
+		} else {
+			haveAllKeys = false
 		}
 	}
 
-	// Let the user know if we're logging
-	Print("Logging")
-
-	// If none explicitly selected then use all
-	if !(useChatGPT || useGemini || usePerplexity || useCerebras) {
-		useChatGPT, useGemini, usePerplexity, useCerebras = true, true, true, true
-	}
-
-	if !connected {
-		Fatalf("Not connected to the internet. Err is %v\n", err)
-	}
-
-	// Check we have API keys as required
-	if useChatGPT && getChatGPTAPIKey() == "" {
-		Fatalf("Please set environment variable %s to use ChatGPT", chatGPTApiKey)
-	}
+	if haveAnyKeys {
+		builder.WriteString("\n\tSetup:\n")
 
-	if useGemini && getGeminiAPIKey() == "" {
-		Fatalf("Please set environment variable %s to use Gemini", geminiApiKey)
+		for _, p := range Providers() {
+			if GetAPIKey(p) != "" {
+				fmt.Fprintf(&builder, "\t - You already have %s set\n", p.EnvKey())
+			}
+		}
 	}
+	// TODO: should we do something if impliedly we have none?
 
-	if usePerplexity && getPerplexityAPIKey() == "" {
-		Fatalf("Please set environment variable %s to use Perplexity", perplexityApiKey)
+	if connectedToInternet {
+		builder.WriteString("\t - You are connected to the internet\n")
 	}
 
-	if useCerebras && getCerebrasAPIKey() == "" {
-		Fatalf("Please set environment variable %s to use Cerebras", cerebrasApiKey)
+	if haveAllKeys && connectedToInternet {
+		builder.WriteString("\t - We're ready to rumble :)\n")
 	}
 
-	// --- Read prompt from stdin ---
-	reader := bufio.NewReader(os.Stdin)
-	var promptText string
-
-	// Check if stdin is coming from a pipe or redirection
-	fileInfo, _ := os.Stdin.Stat()
-	isPipe := (fileInfo.Mode() & os.ModeCharDevice) == 0
-
-	if !isPipe {
-		// Interactive mode, display prompt
-		fmt.Print("Prompt (press Ctrl+D when done) > ")
-	}
-	inputBytes, err := io.ReadAll(reader) // Read until EOF
+	builder.WriteString("\n")
+	fmt.Print(builder.String())
+}
 
+func main() {
+	// Extra OpenAI-compatible providers from the config file
+	cfg, err := LoadConfig()
 	if err != nil {
-		Fatalf("Failed to read input: %v", err)
-	}
-	// impliedly input is good
-
-	promptText = strings.TrimSpace(string(inputBytes)) // Convert bytes to string
-
-	// --- Run API calls concurrently ---
-	var wg sync.WaitGroup
-
-	if usePerplexity {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			Print("Hitting Perplexity API ...")
-			Render(PerplexityWrapper(promptText, false, logToJsonl, quietMode))
-		}()
+		Fatalf("%v\n", err)
 	}
-
-	if useChatGPT {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			Print("Hitting ChatGPT API ...")
-			Render(ChatGPTWrapper(promptText, false, logToJsonl, quietMode))
-		}()
-	}
-
-	if useGemini {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			Print("Hitting Gemini API ...")
-			Render(GeminiWrapper(promptText, false, logToJsonl, quietMode))
-		}()
+	if err := RegisterConfigProviders(cfg); err != nil {
+		Fatalf("%v\n", err)
 	}
-
-	if useCerebras {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			Print("Hitting Cerebras API ...")
-			Render(CerebrasWrapper(promptText, false, logToJsonl, quietMode))
-		}()
+	perplexityOptions = cfg.Perplexity
+	baseURLs = cfg.BaseURLs
+	logPath = cfg.LogPath
+	logRotation = cfg.Log
+	renderStyle = cfg.RenderStyle
+
+	err = Run(cfg, os.Args[1:])
+	if errors.Is(err, errProvidersFailed) {
+		// Already reported
+		os.Exit(1)
 	}
-
-	// Wait here ensures main doesn't exit before goroutines finish
-	wg.Wait()
-
-	if !quietMode {
-		RenderWithGlamour("\n# Done\n")
+	if err != nil {
+		Fatalf("%v\n", err)
 	}
 }
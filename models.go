@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// ParseModelFlag parses a --model value into models, keyed by lower case
+// provider name. The value is either a bare model, which applies to every
+// selected provider, or a comma separated list of provider=model pairs e.g.
+// gemini=models/gemini-2.5-flash,chatgpt=gpt-4.1
+func ParseModelFlag(value string, models map[string]string) error {
+	for _, each := range strings.Split(value, ",") {
+		each = strings.TrimSpace(each)
+		if each == "" {
+			continue
+		}
+
+		name, model, found := strings.Cut(each, "=")
+		if !found {
+			models[""] = each
+			continue
+		}
+
+		p, ok := LookupProvider(strings.TrimSpace(name))
+		if !ok {
+			return fmt.Errorf("unknown provider %q in --model %s", name, value)
+		}
+		models[strings.ToLower(p.Name())] = strings.TrimSpace(model)
+	}
+	return nil
+}
+
+var nonAlnum = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// modelEnvKey is the environment variable for a provider's default model,
+// e.g. GOLLM_GEMINI_MODEL
+func modelEnvKey(p Provider) string {
+	return "GOLLM_" + nonAlnum.ReplaceAllString(strings.ToUpper(p.Name()), "_") + "_MODEL"
+}
+
+// ResolveModel picks the model for p from, in order of precedence, the
+// --model flag, the environment and the config file. It returns "" if none
+// are set, leaving the provider to use its own default
+func ResolveModel(p Provider, flagModels map[string]string, cfg Config) string {
+	name := strings.ToLower(p.Name())
+
+	if model := flagModels[name]; model != "" {
+		return model
+	}
+	if model := flagModels[""]; model != "" {
+		return model
+	}
+	if model := os.Getenv(modelEnvKey(p)); model != "" {
+		return model
+	}
+	for key, model := range cfg.Models {
+		if strings.ToLower(key) == name {
+			return model
+		}
+	}
+	return ""
+}
+
+// modelProviders are the starts of the model names of each provider, to
+// tell which provider answered log entries from before the provider was
+// logged
+var modelProviders = map[string]string{
+	"gpt-":            "ChatGPT",
+	"chatgpt-":        "ChatGPT",
+	"o1":              "ChatGPT",
+	"o3":              "ChatGPT",
+	"o4":              "ChatGPT",
+	"gemini":          "Gemini",
+	"claude":          "Anthropic",
+	"sonar":           "Perplexity",
+	"llama-3.1-sonar": "Perplexity",
+	"llama":           "Cerebras",
+}
+
+// ProviderForModel guesses the provider of model by the longest name which
+// starts it, as LookupPrice does. Gemini's models/ prefix is ignored
+func ProviderForModel(model string) (Provider, bool) {
+	model = strings.TrimPrefix(strings.ToLower(model), "models/")
+
+	var best string
+	for start := range modelProviders {
+		if strings.HasPrefix(model, start) && len(start) > len(best) {
+			best = start
+		}
+	}
+	if best == "" {
+		return nil, false
+	}
+	return LookupProvider(modelProviders[best])
+}
@@ -0,0 +1,57 @@
+package main
+
+import "testing"
+
+func TestParseModelFlag(t *testing.T) {
+	models := map[string]string{}
+	if err := ParseModelFlag("gemini=models/gemini-2.5-flash, ChatGPT=gpt-4.1", models); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if models["gemini"] != "models/gemini-2.5-flash" || models["chatgpt"] != "gpt-4.1" {
+		t.Errorf("Unexpected models %v", models)
+	}
+
+	if err := ParseModelFlag("nonesuch=foo", models); err == nil {
+		t.Error("Expected an error for an unknown provider")
+	}
+}
+
+func TestResolveModel(t *testing.T) {
+	p, _ := LookupProvider("gemini")
+	cfg := Config{Models: map[string]string{"Gemini": "from-config"}}
+
+	t.Setenv("GOLLM_GEMINI_MODEL", "")
+	if model := ResolveModel(p, map[string]string{}, cfg); model != "from-config" {
+		t.Errorf("Expected config model, got %s", model)
+	}
+
+	t.Setenv("GOLLM_GEMINI_MODEL", "from-env")
+	if model := ResolveModel(p, map[string]string{}, cfg); model != "from-env" {
+		t.Errorf("Expected env to beat config, got %s", model)
+	}
+
+	if model := ResolveModel(p, map[string]string{"": "bare"}, cfg); model != "bare" {
+		t.Errorf("Expected bare flag to beat env, got %s", model)
+	}
+
+	if model := ResolveModel(p, map[string]string{"": "bare", "gemini": "named"}, cfg); model != "named" {
+		t.Errorf("Expected named flag to beat bare flag, got %s", model)
+	}
+}
+
+func TestProviderForModel(t *testing.T) {
+	for model, want := range map[string]string{
+		"gpt-4o-2024-08-06":                   "ChatGPT",
+		"models/gemini-2.5-pro-preview-03-25": "Gemini",
+		"claude-3-5-sonnet":                   "Anthropic",
+		"llama-3.1-sonar-large-128k-online":   "Perplexity",
+		"llama-4-scout-17b-16e-instruct":      "Cerebras",
+	} {
+		if p, ok := ProviderForModel(model); !ok || p.Name() != want {
+			t.Errorf("Expected %s for %s, got %v", want, model, p)
+		}
+	}
+	if p, ok := ProviderForModel("mystery"); ok {
+		t.Errorf("Expected no provider for an unknown model, got %s", p.Name())
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// See https://github.com/ollama/ollama/blob/main/docs/api.md
+// OLLAMA_HOST is the same variable the ollama CLI uses, and like the CLI we
+// accept it with or without a scheme
+const ollamaHostEnv = "OLLAMA_HOST"
+const ollamaDefaultHost = "http://localhost:11434"
+
+// OLLAMA_MODEL picks the model if none was asked for; failing that we use
+// the first one installed
+const ollamaModelEnv = "OLLAMA_MODEL"
+
+type ollamaProvider struct{}
+
+func init() {
+	RegisterProvider(ollamaProvider{})
+}
+
+func (ollamaProvider) Name() string   { return "Ollama" }
+func (ollamaProvider) Flag() string   { return "o" }
+func (ollamaProvider) EnvKey() string { return "" }
+
+func (ollamaProvider) Capabilities() Capabilities {
+	return Capabilities{ListModels: true, Local: true, Stream: true, Params: allParams}
+}
+
+type OllamaChatRequest struct {
+	Model    string         `json:"model"`
+	Messages []Message      `json:"messages"`
+	Stream   bool           `json:"stream"`
+	Options  *OllamaOptions `json:"options,omitempty"`
+}
+
+// OllamaOptions are the model parameters we set, see
+// https://github.com/ollama/ollama/blob/main/docs/modelfile.md#valid-parameters-and-values
+type OllamaOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	NumPredict  *int     `json:"num_predict,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+	Seed        *int64   `json:"seed,omitempty"`
+}
+
+// ollamaOptions translates params, or returns nil if none are set
+func ollamaOptions(params GenerationParams) *OllamaOptions {
+	if params.IsZero() {
+		return nil
+	}
+	return &OllamaOptions{
+		Temperature: params.Temperature,
+		NumPredict:  params.MaxTokens,
+		TopP:        params.TopP,
+		Stop:        params.Stop,
+		Seed:        params.Seed,
+	}
+}
+
+type OllamaChatResponse struct {
+	Model           string  `json:"model"`
+	CreatedAt       string  `json:"created_at"`
+	Message         Message `json:"message"`
+	Done            bool    `json:"done"`
+	DoneReason      string  `json:"done_reason"`
+	PromptEvalCount int     `json:"prompt_eval_count"`
+	EvalCount       int     `json:"eval_count"`
+}
+
+type OllamaModel struct {
+	Name       string `json:"name"`
+	ModifiedAt string `json:"modified_at"`
+	Size       int64  `json:"size"`
+	Details    struct {
+		Family            string `json:"family"`
+		ParameterSize     string `json:"parameter_size"`
+		QuantizationLevel string `json:"quantization_level"`
+	} `json:"details"`
+}
+
+type OllamaTagsResponse struct {
+	Models []OllamaModel `json:"models"`
+}
+
+// ollamaBaseURL returns the Ollama server address from OLLAMA_HOST, falling
+// back to the default local address
+func ollamaBaseURL() string {
+	host := os.Getenv(ollamaHostEnv)
+	if host == "" {
+		return ResolveBaseURL(ollamaProvider{}.Name(), "", ollamaDefaultHost)
+	}
+	if !strings.HasPrefix(host, "http://") && !strings.HasPrefix(host, "https://") {
+		host = "http://" + host
+	}
+	return strings.TrimSuffix(host, "/")
+}
+
+// ollamaSend sends a request to the Ollama server, returning the response if
+// it was successful
+func ollamaSend(ctx context.Context, method string, path string, body any) (*http.Response, error) {
+	var payload io.Reader
+	if body != nil {
+		jsonData, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+		payload = bytes.NewReader(jsonData)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, ollamaBaseURL()+path, payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Add("Content-Type", "application/json")
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("is ollama running? %w", err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		resBody, _ := io.ReadAll(res.Body)
+		return nil, fmt.Errorf("ollama returned %w", &HTTPStatusError{StatusCode: res.StatusCode, Status: res.Status, Header: res.Header, Message: strings.TrimSpace(string(resBody))})
+	}
+
+	return res, nil
+}
+
+// ollamaDo sends a request to the Ollama server and decodes the JSON reply into out
+func ollamaDo(ctx context.Context, method string, path string, body any, out any) error {
+	res, err := ollamaSend(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if err := json.Unmarshal(resBody, out); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w\nResponse was: %s", err, resBody)
+	}
+
+	return nil
+}
+
+// OllamaModels returns the models installed on the Ollama server
+func OllamaModels(ctx context.Context) ([]OllamaModel, error) {
+	var tags OllamaTagsResponse
+	if err := ollamaDo(ctx, http.MethodGet, "/api/tags", nil, &tags); err != nil {
+		return nil, err
+	}
+	return tags.Models, nil
+}
+
+func (ollamaProvider) ListModels(ctx context.Context) (string, error) {
+	models, err := OllamaModels(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	var builder strings.Builder
+	builder.WriteString("Available Ollama Models:\n")
+	for _, model := range models {
+		fmt.Fprintf(&builder, "- %s: %s %s %s, Modified: %s\n", model.Name, model.Details.Family, model.Details.ParameterSize, model.Details.QuantizationLevel, model.ModifiedAt)
+	}
+	return builder.String(), nil
+}
+
+// ollamaModel works out which model to use
+func ollamaModel(ctx context.Context, requested string) (string, error) {
+	if requested != "" {
+		return requested, nil
+	}
+	if model := os.Getenv(ollamaModelEnv); model != "" {
+		return model, nil
+	}
+
+	models, err := OllamaModels(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(models) == 0 {
+		return "", fmt.Errorf("no models installed, try `ollama pull` or set %s", ollamaModelEnv)
+	}
+	return models[0].Name, nil
+}
+
+func OllamaGenChatResponseMock() *OllamaChatResponse {
+	return &OllamaChatResponse{
+		Model:     "llama3.2",
+		CreatedAt: "2025-04-24T09:15:54.123456Z",
+		Message: Message{
+			Role:    "assistant",
+			Content: "This is a mocked Ollama response.",
+		},
+		Done:            true,
+		DoneReason:      "stop",
+		PromptEvalCount: 10,
+		EvalCount:       5,
+	}
+}
+
+// OllamaCallAPI calls /api/chat on the Ollama server
+func OllamaCallAPI(ctx context.Context, req Request) (*OllamaChatResponse, error) {
+	if req.Mock {
+		return OllamaGenChatResponseMock(), nil
+	}
+
+	model, err := ollamaModel(ctx, req.Model)
+	if err != nil {
+		return nil, err
+	}
+
+	chatRequest := OllamaChatRequest{
+		Model:    model,
+		Messages: req.Messages(),
+		Stream:   false,
+		Options:  ollamaOptions(req.Params),
+	}
+
+	var chatResponse OllamaChatResponse
+	if err := ollamaDo(ctx, http.MethodPost, "/api/chat", chatRequest, &chatResponse); err != nil {
+		return nil, err
+	}
+
+	return &chatResponse, nil
+}
+
+func (ollamaProvider) Complete(ctx context.Context, req Request) (ModelResponse, error) {
+	c, err := OllamaCallAPI(ctx, req)
+	if err != nil {
+		return ModelResponse{}, err
+	}
+
+	return modelResponseFromOllama(c), nil
+}
+
+// Stream reads the newline delimited JSON Ollama sends when "stream" is
+// true; the final object has done set along with the token counts
+func (ollamaProvider) Stream(ctx context.Context, req Request, onToken func(string)) (ModelResponse, error) {
+	model, err := ollamaModel(ctx, req.Model)
+	if err != nil {
+		return ModelResponse{}, err
+	}
+
+	res, err := ollamaSend(ctx, http.MethodPost, "/api/chat", OllamaChatRequest{
+		Model:    model,
+		Messages: req.Messages(),
+		Stream:   true,
+		Options:  ollamaOptions(req.Params),
+	})
+	if err != nil {
+		return ModelResponse{}, err
+	}
+	defer res.Body.Close()
+
+	var last OllamaChatResponse
+	var content strings.Builder
+
+	decoder := json.NewDecoder(res.Body)
+	for {
+		var chunk OllamaChatResponse
+		err := decoder.Decode(&chunk)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return ModelResponse{}, fmt.Errorf("failed to decode chunk: %w", err)
+		}
+
+		content.WriteString(chunk.Message.Content)
+		onToken(chunk.Message.Content)
+		last = chunk
+	}
+
+	last.Message.Content = content.String()
+	return modelResponseFromOllama(&last), nil
+}
+
+func modelResponseFromOllama(c *OllamaChatResponse) ModelResponse {
+	finishReason := c.DoneReason
+	if finishReason == "" {
+		finishReason = "None"
+	}
+
+	return ModelResponse{
+		Model:            c.Model,
+		TotalTokens:      c.PromptEvalCount + c.EvalCount,
+		PromptTokens:     c.PromptEvalCount,
+		CompletionTokens: c.EvalCount,
+		Content:          c.Message.Content,
+		FinishReason:     finishReason,
+	}
+}
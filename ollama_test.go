@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOllamaProvider(t *testing.T) {
+	quietMode = true
+	response, duration, err := CompleteProvider(context.Background(), ollamaProvider{}, Request{Prompt: "Mock prompt", Mock: true}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Render(FmtModelResponse(ollamaProvider{}.Name(), response, duration, quietMode))
+}
+
+func TestOllamaCallAPI(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/tags":
+			w.Write([]byte(`{"models":[{"name":"llama3.2:latest","details":{"family":"llama","parameter_size":"3.2B"}}]}`))
+		case "/api/chat":
+			var chatRequest OllamaChatRequest
+			if err := json.NewDecoder(r.Body).Decode(&chatRequest); err != nil {
+				t.Errorf("Failed to decode request: %v", err)
+			}
+			if chatRequest.Model != "llama3.2:latest" {
+				t.Errorf("Expected first installed model to be used, got %s", chatRequest.Model)
+			}
+			if chatRequest.Stream {
+				t.Error("Expected stream to be false")
+			}
+			if len(chatRequest.Messages) != 2 || chatRequest.Messages[0].Role != "system" || chatRequest.Messages[0].Content != "Be brief" {
+				t.Errorf("Expected a system message then the prompt, got %+v", chatRequest.Messages)
+			}
+			if chatRequest.Options == nil || chatRequest.Options.NumPredict == nil || *chatRequest.Options.NumPredict != 50 {
+				t.Errorf("Expected max tokens as num_predict, got %+v", chatRequest.Options)
+			}
+			w.Write([]byte(`{"model":"llama3.2:latest","message":{"role":"assistant","content":"Hello from ollama"},"done":true,"done_reason":"stop","prompt_eval_count":7,"eval_count":3}`))
+		default:
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	// Without a scheme, as the ollama CLI allows
+	t.Setenv(ollamaHostEnv, strings.TrimPrefix(server.URL, "http://"))
+	t.Setenv(ollamaModelEnv, "")
+
+	maxTokens := 50
+	response, err := ollamaProvider{}.Complete(context.Background(), Request{Prompt: "Hi", System: "Be brief", Params: GenerationParams{MaxTokens: &maxTokens}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if response.Content != "Hello from ollama" {
+		t.Errorf("Unexpected content %q", response.Content)
+	}
+	if response.TotalTokens != 10 {
+		t.Errorf("Expected 10 tokens, got %d", response.TotalTokens)
+	}
+
+	models, err := ollamaProvider{}.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(models, "llama3.2:latest") {
+		t.Errorf("Expected model listing to include llama3.2:latest, got %s", models)
+	}
+}
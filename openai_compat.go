@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+// openAICompatProvider is any OpenAI-compatible endpoint declared in the
+// config file, e.g. Groq, Mistral, OpenRouter, DeepSeek, vLLM or llama.cpp
+type openAICompatProvider struct {
+	cfg ProviderConfig
+}
+
+func (p openAICompatProvider) Name() string   { return p.cfg.Name }
+func (p openAICompatProvider) Flag() string   { return p.cfg.Flag }
+func (p openAICompatProvider) EnvKey() string { return p.cfg.KeyEnv }
+
+func (p openAICompatProvider) Capabilities() Capabilities {
+	return Capabilities{ListModels: true, Local: p.cfg.Local, Stream: true, Params: allParams}
+}
+
+// RegisterConfigProviders registers the providers declared in the config file
+func RegisterConfigProviders(cfg Config) error {
+	for _, each := range cfg.Providers {
+		if each.Name == "" || each.Flag == "" || each.BaseURL == "" {
+			return fmt.Errorf("provider %q in config needs a name, flag and base_url", each.Name)
+		}
+		if err := registerProvider(openAICompatProvider{cfg: each}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// client builds an openai-go client pointed at the configured base URL
+func (p openAICompatProvider) client() openai.Client {
+	opts := []option.RequestOption{option.WithBaseURL(p.cfg.BaseURL), option.WithMaxRetries(0)}
+
+	if p.cfg.KeyEnv != "" {
+		opts = append(opts, option.WithAPIKey(GetAPIKey(p)))
+	} else {
+		// The client picks up OPENAI_* from the environment by default and
+		// we don't want to hand those to somebody else's server
+		opts = append(opts,
+			option.WithHeaderDel("authorization"),
+			option.WithHeaderDel("OpenAI-Organization"),
+			option.WithHeaderDel("OpenAI-Project"),
+		)
+	}
+
+	return openai.NewClient(opts...)
+}
+
+func (p openAICompatProvider) ListModels(ctx context.Context) (string, error) {
+	client := p.client()
+
+	resp, err := client.Models.List(ctx)
+	if err != nil {
+		return "", fmt.Errorf("error listing models: %w", err)
+	}
+
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "Available %s Models:\n", p.cfg.Name)
+	for _, model := range resp.Data {
+		fmt.Fprintf(&builder, "- %s\n", model.ID)
+	}
+	return builder.String(), nil
+}
+
+func (p openAICompatProvider) Complete(ctx context.Context, req Request) (ModelResponse, error) {
+	model := req.ModelOr(p.cfg.Model)
+	if model == "" {
+		return ModelResponse{}, fmt.Errorf("no model set for %s in config", p.cfg.Name)
+	}
+
+	if req.Mock {
+		return ModelResponse{
+			Model:        model,
+			TotalTokens:  15,
+			Content:      fmt.Sprintf("This is a mocked %s response.", p.cfg.Name),
+			FinishReason: "stop",
+		}, nil
+	}
+
+	client := p.client()
+	chatCompletion, err := client.Chat.Completions.New(ctx, ChatCompletionParams(req, model))
+	if err != nil {
+		return ModelResponse{}, err
+	}
+
+	return ModelResponseFromChatCompletion(chatCompletion), nil
+}
+
+func (p openAICompatProvider) Stream(ctx context.Context, req Request, onToken func(string)) (ModelResponse, error) {
+	model := req.ModelOr(p.cfg.Model)
+	if model == "" {
+		return ModelResponse{}, fmt.Errorf("no model set for %s in config", p.cfg.Name)
+	}
+
+	c, err := StreamChatCompletion(ctx, p.client(), ChatCompletionParams(req, model), onToken)
+	if err != nil {
+		return ModelResponse{}, err
+	}
+	return ModelResponseFromChatCompletion(c), nil
+}
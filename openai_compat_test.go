@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenAICompatProvider(t *testing.T) {
+	t.Setenv("TEST_COMPAT_API_KEY", "test-api-key")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("Expected path /v1/chat/completions, got %s", r.URL.Path)
+		}
+		if r.Header.Get("Authorization") != "Bearer test-api-key" {
+			t.Errorf("Expected Authorization header Bearer test-api-key, got %s", r.Header.Get("Authorization"))
+		}
+
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		if body["model"] != "compat-model" {
+			t.Errorf("Expected model compat-model, got %v", body["model"])
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{
+			"id": "compat-123",
+			"object": "chat.completion",
+			"created": 1700000000,
+			"model": "compat-model",
+			"choices": [{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "Hello from compat"}}],
+			"usage": {"prompt_tokens": 4, "completion_tokens": 3, "total_tokens": 7}
+		}`))
+	}))
+	defer server.Close()
+
+	p := openAICompatProvider{cfg: ProviderConfig{
+		Name:    "Compat",
+		Flag:    "cm",
+		BaseURL: server.URL + "/v1",
+		KeyEnv:  "TEST_COMPAT_API_KEY",
+		Model:   "compat-model",
+	}}
+
+	response, err := p.Complete(context.Background(), Request{Prompt: "Hi"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if response.Content != "Hello from compat" {
+		t.Errorf("Unexpected content %q", response.Content)
+	}
+	if response.TotalTokens != 7 || response.PromptTokens != 4 || response.CompletionTokens != 3 {
+		t.Errorf("Expected 7 tokens, 4 in and 3 out, got %+v", response)
+	}
+}
+
+func TestLoadConfigProviders(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	t.Setenv(configPathEnv, configPath)
+
+	// A missing file is fine
+	if _, err := LoadConfig(); err != nil {
+		t.Fatalf("Unexpected error for missing config: %v", err)
+	}
+
+	err := os.WriteFile(configPath, []byte(`
+[[providers]]
+name = "Groq"
+flag = "gr"
+base_url = "https://api.groq.com/openai/v1"
+key_env = "GROQ_API_KEY"
+model = "llama-3.3-70b-versatile"
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(cfg.Providers) != 1 || cfg.Providers[0].Flag != "gr" {
+		t.Errorf("Unexpected providers %+v", cfg.Providers)
+	}
+}
+
+func TestRegisterProviderReservedFlag(t *testing.T) {
+	err := registerProvider(openAICompatProvider{cfg: ProviderConfig{Name: "Quiet", Flag: "q"}})
+	if err == nil {
+		t.Error("Expected -q to be refused as it is an option")
+	}
+}
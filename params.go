@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// GenerationParams are sampling parameters; nil or empty means the
+// provider's default
+type GenerationParams struct {
+	Temperature *float64 `toml:"temperature" json:"temperature,omitempty"`
+	MaxTokens   *int     `toml:"max_tokens" json:"max_tokens,omitempty"`
+	TopP        *float64 `toml:"top_p" json:"top_p,omitempty"`
+	// Stop sequences end the response when generated
+	Stop []string `toml:"stop,omitempty" json:"stop,omitempty"`
+	Seed *int64   `toml:"seed" json:"seed,omitempty"`
+}
+
+// ParamSupport says which generation params a provider accepts
+type ParamSupport struct {
+	Temperature bool
+	MaxTokens   bool
+	TopP        bool
+	Stop        bool
+	Seed        bool
+	// MaxTemperature is the highest temperature accepted, if it's less than 2
+	MaxTemperature float64
+}
+
+// allParams is for providers which accept all of them
+var allParams = ParamSupport{Temperature: true, MaxTokens: true, TopP: true, Stop: true, Seed: true}
+
+// Validate checks the params are in range
+func (params GenerationParams) Validate() error {
+	if params.Temperature != nil && (*params.Temperature < 0 || *params.Temperature > 2) {
+		return fmt.Errorf("temperature should be between 0 and 2, not %g", *params.Temperature)
+	}
+	if params.TopP != nil && (*params.TopP <= 0 || *params.TopP > 1) {
+		return fmt.Errorf("top_p should be more than 0 and at most 1, not %g", *params.TopP)
+	}
+	if params.MaxTokens != nil && *params.MaxTokens <= 0 {
+		return fmt.Errorf("max_tokens should be positive, not %d", *params.MaxTokens)
+	}
+	return nil
+}
+
+// IsZero is true if no params are set
+func (params GenerationParams) IsZero() bool {
+	return params.Temperature == nil && params.MaxTokens == nil && params.TopP == nil && len(params.Stop) == 0 && params.Seed == nil
+}
+
+// Override returns params with anything set in with taking precedence
+func (params GenerationParams) Override(with GenerationParams) GenerationParams {
+	if with.Temperature != nil {
+		params.Temperature = with.Temperature
+	}
+	if with.MaxTokens != nil {
+		params.MaxTokens = with.MaxTokens
+	}
+	if with.TopP != nil {
+		params.TopP = with.TopP
+	}
+	if with.Stop != nil {
+		params.Stop = with.Stop
+	}
+	if with.Seed != nil {
+		params.Seed = with.Seed
+	}
+	return params
+}
+
+// Filter returns the params the provider supports, and what was left out and
+// why, so we can warn rather than have the API refuse the request
+func (support ParamSupport) Filter(params GenerationParams) (GenerationParams, []string) {
+	var ignored []string
+
+	if params.Temperature != nil {
+		switch {
+		case !support.Temperature:
+			ignored = append(ignored, "temperature isn't supported")
+			params.Temperature = nil
+		case support.MaxTemperature > 0 && *params.Temperature > support.MaxTemperature:
+			ignored = append(ignored, fmt.Sprintf("temperature %g is more than the maximum of %g", *params.Temperature, support.MaxTemperature))
+			params.Temperature = nil
+		}
+	}
+	if params.MaxTokens != nil && !support.MaxTokens {
+		ignored = append(ignored, "max tokens isn't supported")
+		params.MaxTokens = nil
+	}
+	if params.TopP != nil && !support.TopP {
+		ignored = append(ignored, "top_p isn't supported")
+		params.TopP = nil
+	}
+	if params.Stop != nil && !support.Stop {
+		ignored = append(ignored, "stop sequences aren't supported")
+		params.Stop = nil
+	}
+	if params.Seed != nil && !support.Seed {
+		ignored = append(ignored, "seed isn't supported")
+		params.Seed = nil
+	}
+
+	return params, ignored
+}
+
+func parseFloatParam(value string, param **float64) error {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return err
+	}
+	*param = &f
+	return nil
+}
+
+func parseIntParam(value string, param **int) error {
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return err
+	}
+	*param = &n
+	return nil
+}
+
+func parseSeedParam(value string, param **int64) error {
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return err
+	}
+	*param = &n
+	return nil
+}
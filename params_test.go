@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestGenerationParamsOverride(t *testing.T) {
+	temperature, flagTemperature, maxTokens := 0.2, 0.9, 100
+	cfg := GenerationParams{Temperature: &temperature, MaxTokens: &maxTokens}
+
+	params := cfg.Override(GenerationParams{Temperature: &flagTemperature, Stop: []string{"END"}})
+	if *params.Temperature != 0.9 || *params.MaxTokens != 100 || len(params.Stop) != 1 {
+		t.Errorf("Expected the flag's temperature and stop with the config's max tokens, got %+v", params)
+	}
+}
+
+func TestParamSupportFilter(t *testing.T) {
+	temperature, seed := 1.5, int64(42)
+	params := GenerationParams{Temperature: &temperature, Seed: &seed, Stop: []string{"END"}}
+
+	supported, ignored := anthropicProvider{}.Capabilities().Params.Filter(params)
+	if supported.Temperature != nil || supported.Seed != nil || len(supported.Stop) != 1 {
+		t.Errorf("Expected only stop to be kept for Anthropic, got %+v", supported)
+	}
+	if len(ignored) != 2 || !strings.Contains(ignored[0], "maximum of 1") {
+		t.Errorf("Unexpected reasons %v", ignored)
+	}
+
+	supported, ignored = geminiProvider{}.Capabilities().Params.Filter(params)
+	if supported.Temperature == nil || supported.Seed != nil || len(ignored) != 1 {
+		t.Errorf("Expected Gemini to keep temperature but not seed, got %+v, %v", supported, ignored)
+	}
+}
+
+func TestChatGPTParams(t *testing.T) {
+	temperature, maxTokens, seed := 0.7, 200, int64(42)
+	req := Request{Prompt: "Hi", Params: GenerationParams{Temperature: &temperature, MaxTokens: &maxTokens, Seed: &seed, Stop: []string{"END"}}}
+
+	payload, err := json.Marshal(chatGPTParams(req))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var request map[string]any
+	if err := json.Unmarshal(payload, &request); err != nil {
+		t.Fatal(err)
+	}
+	if request["temperature"] != 0.7 || request["seed"] != float64(42) || request["max_completion_tokens"] != float64(200) {
+		t.Errorf("Unexpected params in %s", payload)
+	}
+	if _, ok := request["max_tokens"]; ok {
+		t.Errorf("Expected max_completion_tokens rather than max_tokens in %s", payload)
+	}
+	if stop, ok := request["stop"].([]any); !ok || len(stop) != 1 || stop[0] != "END" {
+		t.Errorf("Unexpected stop in %s", payload)
+	}
+}
+
+func TestLogEntryParams(t *testing.T) {
+	payload, err := json.Marshal(LogEntry{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(payload), "params") {
+		t.Errorf("Expected no params when none were set, got %s", payload)
+	}
+
+	topP := 0.5
+	payload, err = json.Marshal(LogEntry{Params: GenerationParams{TopP: &topP}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(payload), `"params":{"top_p":0.5}`) {
+		t.Errorf("Expected the params to be logged, got %s", payload)
+	}
+}
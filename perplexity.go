@@ -1,23 +1,218 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
-	"regexp"
 	"strings"
 	"time"
 )
 
+const perplexityApiKey = "PERPLEXITY_API_KEY"
+
+const perplexityDefaultModel = "sonar-pro"
+
+const perplexityBaseURLEnv = "PERPLEXITY_BASE_URL"
+
+const perplexityDefaultBaseURL = "https://api.perplexity.ai"
+
+func perplexityURL() string {
+	return ResolveBaseURL(perplexityProvider{}.Name(), perplexityBaseURLEnv, perplexityDefaultBaseURL) + "/chat/completions"
+}
+
+type perplexityProvider struct{}
+
+// PerplexityOptions are the search options we send with every request; they
+// come from the [perplexity] section of the config and can be overridden by flags
+type PerplexityOptions struct {
+	// AllowDomains limits searches to these domains, DenyDomains excludes these
+	AllowDomains []string `toml:"allow_domains"`
+	DenyDomains  []string `toml:"deny_domains"`
+	// Recency is day, week, month or year, or empty for any time
+	Recency string `toml:"recency"`
+	// ContextSize is how much search context to use: low, medium or high
+	ContextSize      string `toml:"context_size"`
+	ReturnImages     bool   `toml:"return_images"`
+	RelatedQuestions bool   `toml:"related_questions"`
+	SystemPrompt     string `toml:"system_prompt"`
+}
+
+// DefaultPerplexityOptions are what we used before any of this was configurable
+func DefaultPerplexityOptions() PerplexityOptions {
+	return PerplexityOptions{
+		Recency:      "month",
+		ContextSize:  "high",
+		SystemPrompt: "Be precise and concise.",
+	}
+}
+
+// perplexityOptions is set by main from the config and flags
+var perplexityOptions = DefaultPerplexityOptions()
+
+// Validate checks the options against what the API accepts
+func (o PerplexityOptions) Validate() error {
+	switch o.Recency {
+	case "", "day", "week", "month", "year":
+	default:
+		return fmt.Errorf("perplexity recency should be day, week, month or year, not %q", o.Recency)
+	}
+
+	switch o.ContextSize {
+	case "low", "medium", "high":
+	default:
+		return fmt.Errorf("perplexity context size should be low, medium or high, not %q", o.ContextSize)
+	}
+
+	return nil
+}
+
+// PerplexityRequest is the body of a chat completions request, see
+// https://docs.perplexity.ai/api-reference/chat-completions
+type PerplexityRequest struct {
+	Model       string    `json:"model"`
+	Messages    []Message `json:"messages"`
+	MaxTokens   int       `json:"max_tokens"`
+	Temperature float64   `json:"temperature"`
+	TopP        float64   `json:"top_p"`
+	// SearchDomainFilter allows domains, or denies them if prefixed with -
+	SearchDomainFilter     []string             `json:"search_domain_filter,omitempty"`
+	ReturnImages           bool                 `json:"return_images"`
+	ReturnRelatedQuestions bool                 `json:"return_related_questions"`
+	SearchRecencyFilter    string               `json:"search_recency_filter,omitempty"`
+	TopK                   int                  `json:"top_k"`
+	Stream                 bool                 `json:"stream"`
+	PresencePenalty        float64              `json:"presence_penalty"`
+	FrequencyPenalty       float64              `json:"frequency_penalty"`
+	WebSearchOptions       PerplexityWebOptions `json:"web_search_options"`
+}
+
+type PerplexityWebOptions struct {
+	SearchContextSize string `json:"search_context_size"`
+}
+
+func init() {
+	RegisterProvider(perplexityProvider{})
+}
+
+func (perplexityProvider) Name() string   { return "Perplexity" }
+func (perplexityProvider) Flag() string   { return "p" }
+func (perplexityProvider) EnvKey() string { return perplexityApiKey }
+
+func (perplexityProvider) Capabilities() Capabilities {
+	return Capabilities{Citations: true, Stream: true, Params: ParamSupport{Temperature: true, MaxTokens: true, TopP: true}}
+}
+
+func (perplexityProvider) SystemPrompt() string {
+	return perplexityOptions.SystemPrompt
+}
+
+func (perplexityProvider) Complete(ctx context.Context, req Request) (ModelResponse, error) {
+	result, _, err := CallPerplexityAPI(ctx, perplexityRequest(req, false), req.Mock)
+	if err != nil {
+		return ModelResponse{}, err
+	}
+	return ParsePerplexityResponse(result)
+}
+
+// Stream reads the server-sent events Perplexity sends back when "stream" is true
+func (perplexityProvider) Stream(ctx context.Context, req Request, onToken func(string)) (ModelResponse, error) {
+	payload, err := json.Marshal(perplexityRequest(req, true))
+	if err != nil {
+		return ModelResponse{}, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, perplexityURL(), bytes.NewReader(payload))
+	if err != nil {
+		return ModelResponse{}, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	key, err := RequireAPIKey(perplexityApiKey)
+	if err != nil {
+		return ModelResponse{}, err
+	}
+
+	httpReq.Header.Add("Authorization", fmt.Sprintf("Bearer %s", key))
+	httpReq.Header.Add("Content-Type", "application/json")
+	httpReq.Header.Add("Accept", "text/event-stream")
+
+	res, err := httpClient.Do(httpReq)
+	if err != nil {
+		return ModelResponse{}, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(res.Body)
+		return ModelResponse{}, &HTTPStatusError{StatusCode: res.StatusCode, Status: res.Status, Header: res.Header, Message: strings.TrimSpace(string(body))}
+	}
+
+	var response ModelResponse
+	var content strings.Builder
+
+	err = readSSE(res.Body, func(event string, data string) error {
+		if data == "[DONE]" {
+			return nil
+		}
+
+		var chunk PerplexityResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("failed to unmarshal chunk: %w\nChunk was: %s", err, data)
+		}
+
+		response.Model = chunk.Model
+		if chunk.Usage.TotalTokens > 0 {
+			chunk.Usage.apply(&response)
+		}
+		if len(chunk.Citations) > 0 {
+			response.Citations = chunk.Citations
+		}
+		if len(chunk.Images) > 0 {
+			response.Images = chunk.ImageURLs()
+		}
+		if len(chunk.RelatedQuestions) > 0 {
+			response.RelatedQuestions = chunk.RelatedQuestions
+		}
+
+		if len(chunk.Choices) > 0 {
+			token := chunk.Choices[0].Delta.Content
+			content.WriteString(token)
+			onToken(token)
+
+			if chunk.Choices[0].FinishReason != "" {
+				response.FinishReason = chunk.Choices[0].FinishReason
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return ModelResponse{}, err
+	}
+
+	response.Content = content.String()
+	return response, nil
+}
+
 type UsageStats struct {
-	PromptTokens      int    `json:"prompt_tokens"`
-	CompletionTokens  int    `json:"completion_tokens"`
-	TotalTokens       int    `json:"total_tokens"`
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+	// ReasoningTokens are part of CompletionTokens, for reasoning models
+	ReasoningTokens   int    `json:"reasoning_tokens"`
 	SearchContextSize string `json:"search_context_size"` // Added based on JSON
 }
 
+// apply sets the token counts of response
+func (usage UsageStats) apply(response *ModelResponse) {
+	response.TotalTokens = usage.TotalTokens
+	response.PromptTokens = usage.PromptTokens
+	response.CompletionTokens = usage.CompletionTokens
+	response.ReasoningTokens = usage.ReasoningTokens
+}
+
 type Message struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
@@ -35,78 +230,127 @@ type Choice struct {
 	Delta        Delta   `json:"delta"` // Added based on JSON
 }
 
+type PerplexityImage struct {
+	ImageURL  string `json:"image_url"`
+	OriginURL string `json:"origin_url"`
+	Height    int    `json:"height"`
+	Width     int    `json:"width"`
+}
+
 type PerplexityResponse struct {
-	ID        string     `json:"id"`
-	Model     string     `json:"model"`
-	Created   int64      `json:"created"` // Use int64 for timestamps
-	Usage     UsageStats `json:"usage"`
-	Citations []string   `json:"citations"` // Added based on JSON
-	Object    string     `json:"object"`
-	Choices   []Choice   `json:"choices"`
+	ID               string            `json:"id"`
+	Model            string            `json:"model"`
+	Created          int64             `json:"created"` // Use int64 for timestamps
+	Usage            UsageStats        `json:"usage"`
+	Citations        []string          `json:"citations"` // Added based on JSON
+	Images           []PerplexityImage `json:"images"`
+	RelatedQuestions []string          `json:"related_questions"`
+	Object           string            `json:"object"`
+	Choices          []Choice          `json:"choices"`
 }
 
-// isValidJSON checks if a string is valid JSON, returning true if it is
-func isValidJSON(jsonStr string) bool {
-	return json.Valid([]byte(jsonStr))
+// ImageURLs returns just the URLs of any images in the response
+func (r PerplexityResponse) ImageURLs() []string {
+	var urls []string
+	for _, image := range r.Images {
+		urls = append(urls, image.ImageURL)
+	}
+	return urls
 }
 
 // ParsePerplexityResponse parses a Perplexity response and returns a ModelResponse
-func ParsePerplexityResponse(result string) ModelResponse {
+func ParsePerplexityResponse(result string) (ModelResponse, error) {
 	var response PerplexityResponse
 	err := json.Unmarshal([]byte(result), &response)
 	if err != nil {
-		Fatalf("Failed to unmarshal hardcoded mock JSON response: %v\nResponse was: %s", err, result)
+		return ModelResponse{}, fmt.Errorf("failed to unmarshal response: %w\nResponse was: %s", err, result)
+	}
+
+	if len(response.Choices) == 0 {
+		return ModelResponse{}, fmt.Errorf("no choices in response: %s", result)
 	}
 
 	model := response.Model
-	totalTokens := response.Usage.TotalTokens
 	citations := response.Citations
 	content := response.Choices[0].Message.Content
 	finishReason := response.Choices[0].FinishReason
 
-	return ModelResponse{
-		Model:        model,
-		TotalTokens:  totalTokens,
-		Citations:    citations,
-		Content:      content,
-		FinishReason: finishReason,
+	modelResponse := ModelResponse{
+		Model:            model,
+		Citations:        citations,
+		Images:           response.ImageURLs(),
+		RelatedQuestions: response.RelatedQuestions,
+		Content:          content,
+		FinishReason:     finishReason,
 	}
+	response.Usage.apply(&modelResponse)
+	return modelResponse, nil
 }
 
-func FmtModelResponse(response ModelResponse, duration time.Duration, quietMode bool) string {
-	var out string
+// NewPerplexityRequest builds the request for promptText with opts
+func NewPerplexityRequest(promptText string, model string, stream bool, opts PerplexityOptions) PerplexityRequest {
+	// Optional fields not used:
+	// "response_format": {},
 
-	if !quietMode {
-		out += fmt.Sprintf("Model: %s, %d tokens used, finished due to: %s, duration: %.3f seconds\n", response.Model, response.TotalTokens, response.FinishReason, duration.Seconds())
+	var messages []Message
+	if opts.SystemPrompt != "" {
+		messages = append(messages, Message{Role: "system", Content: opts.SystemPrompt})
 	}
+	messages = append(messages, Message{Role: "user", Content: promptText})
 
-	// Replace e.g. [1] with [^1] in response.Content using a regex
-	re := regexp.MustCompile(`\[(\d+)\]`)
-	formattedContent := re.ReplaceAllString(response.Content, "[^$1]")
-
-	out += fmt.Sprintf("\n%s\n\n", formattedContent)
+	domains := append([]string{}, opts.AllowDomains...)
+	for _, domain := range opts.DenyDomains {
+		domains = append(domains, "-"+domain)
+	}
 
-	// Markdown citations
-	for idx, citation := range response.Citations {
-		out += fmt.Sprintf("[^%d]: %s\n", idx+1, citation)
+	return PerplexityRequest{
+		Model:                  model,
+		Messages:               messages,
+		MaxTokens:              4000,
+		Temperature:            0.2,
+		TopP:                   0.9,
+		SearchDomainFilter:     domains,
+		ReturnImages:           opts.ReturnImages,
+		ReturnRelatedQuestions: opts.RelatedQuestions,
+		SearchRecencyFilter:    opts.Recency,
+		TopK:                   0,
+		Stream:                 stream,
+		PresencePenalty:        0,
+		FrequencyPenalty:       1,
+		WebSearchOptions:       PerplexityWebOptions{SearchContextSize: opts.ContextSize},
 	}
+}
 
-	out += "\n\nCitations:\n\n"
+// perplexityRequest builds the request for req with the current options,
+// and any system prompt and generation params in place of our defaults
+func perplexityRequest(req Request, stream bool) PerplexityRequest {
+	opts := perplexityOptions
+	if req.System != "" {
+		opts.SystemPrompt = req.System
+	}
+	body := NewPerplexityRequest(req.Prompt, req.ModelOr(perplexityDefaultModel), stream, opts)
 
-	// Non-markdown citations
-	for idx, citation := range response.Citations {
-		out += fmt.Sprintf("%d. %s\n", idx+1, citation)
+	// The history goes between the system prompt and the prompt
+	if len(req.History) > 0 {
+		last := len(body.Messages) - 1
+		body.Messages = append(append(body.Messages[:last:last], req.History...), body.Messages[last])
 	}
 
-	if quietMode {
-		return out + "\n"
-	} // implied else
+	if req.Params.Temperature != nil {
+		body.Temperature = *req.Params.Temperature
+	}
+	if req.Params.MaxTokens != nil {
+		body.MaxTokens = *req.Params.MaxTokens
+	}
+	if req.Params.TopP != nil {
+		body.TopP = *req.Params.TopP
+	}
 
-	return "# Perplexity\n" + out + "\n"
+	return body
 }
 
-// CallPerplexityAPI calls the Perplexity API
-func CallPerplexityAPI(promptText string, mock bool) (string, time.Duration) {
+// CallPerplexityAPI sends request to the Perplexity API
+func CallPerplexityAPI(ctx context.Context, request PerplexityRequest, mock bool) (string, time.Duration, error) {
 	// Start the timer
 	startTime := time.Now()
 
@@ -147,59 +391,24 @@ func CallPerplexityAPI(promptText string, mock bool) (string, time.Duration) {
       }
     }
   ]
-}`, time.Since(startTime)
+}`, time.Since(startTime), nil
 	}
 
-	perplexityApiKey := "PERPLEXITY_API_KEY"
-	key := os.Getenv(perplexityApiKey)
-	url := "https://api.perplexity.ai/chat/completions"
-
-	// Optional fields not used:
-	// "response_format": {},
-
-	payloadStr := fmt.Sprintf(`{
-  "model": "sonar-pro",
-  "messages": [
-    {
-      "role": "system",
-      "content": "Be precise and concise."
-    },
-    {
-      "role": "user",
-      "content": "%s"
-    }
-  ],
-  "max_tokens": 4000,
-  "temperature": 0.2,
-  "top_p": 0.9,
-  "search_domain_filter": [],
-  "return_images": false,
-  "return_related_questions": false,
-  "search_recency_filter": "month",
-  "top_k": 0,
-  "stream": false,
-  "presence_penalty": 0,
-  "frequency_penalty": 1,
-  "web_search_options": {
-    "search_context_size": "high"
-  }
-}`, promptText)
-
-	// fmt.Printf(`
-	// url: %s
-	// payload: %s
-	// `, url, payloadStr)
-
-	// Check we're valid
-	valid := isValidJSON(payloadStr)
-
-	if !valid {
-		Fatalf("JSON not valid")
+	key, err := RequireAPIKey(perplexityApiKey)
+	if err != nil {
+		return "", time.Since(startTime), err
 	}
+	url := perplexityURL()
 
-	payload := strings.NewReader(payloadStr)
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return "", time.Since(startTime), fmt.Errorf("failed to marshal request: %w", err)
+	}
 
-	req, _ := http.NewRequest("POST", url, payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return "", time.Since(startTime), fmt.Errorf("failed to create request: %w", err)
+	}
 
 	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", key))
 	req.Header.Add("Content-Type", "application/json")
@@ -207,49 +416,23 @@ func CallPerplexityAPI(promptText string, mock bool) (string, time.Duration) {
 	// Print the request
 	// fmt.Printf("%+v", req)
 
-	res, _ := http.DefaultClient.Do(req)
-
-	// Print the response
-	// fmt.Printf("%+v", res)
-
-	if res.StatusCode != 200 {
-		fmt.Printf("Some issue: %+v", res)
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return "", time.Since(startTime), err
 	}
-
 	defer res.Body.Close()
-	body, _ := io.ReadAll(res.Body)
-
-	return string(body), time.Since(startTime)
-}
-
-func PerplexityWrapper(promptText string, mock bool, logToJsonl bool, quietMode bool) string {
-	var response PerplexityResponse
 
-	result, duration := CallPerplexityAPI(promptText, mock)
+	// Print the response
+	// fmt.Printf("%+v", res)
 
-	err := json.Unmarshal([]byte(result), &response)
+	body, err := io.ReadAll(res.Body)
 	if err != nil {
-		Fatalf("Failed to unmarshal hardcoded mock JSON response: %v\nResponse was: %s", err, result)
+		return "", time.Since(startTime), fmt.Errorf("failed to read response: %w", err)
 	}
 
-	modelResponse := ParsePerplexityResponse(result)
-
-	// Log successful model call only if logging is enabled
-	if logToJsonl {
-		logEntry := LogEntry{
-			ModelName:     modelResponse.Model,
-			TotalTokens:   modelResponse.TotalTokens,
-			Duration:      duration.Seconds(),
-			StopReason:    modelResponse.FinishReason,
-			PromptText:    promptText,
-			ModelResponse: modelResponse.Content,
-			Timestamp:     time.Now(),
-		}
-		if err := WriteLogEntry(logEntry); err != nil {
-			// Log error but don't fail the request
-			fmt.Fprintf(os.Stderr, "Failed to write log entry: %v\n", err)
-		}
+	if res.StatusCode != http.StatusOK {
+		return "", time.Since(startTime), &HTTPStatusError{StatusCode: res.StatusCode, Status: res.Status, Header: res.Header, Message: strings.TrimSpace(string(body))}
 	}
 
-	return FmtModelResponse(modelResponse, duration, quietMode)
+	return string(body), time.Since(startTime), nil
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -9,11 +10,15 @@ import (
 	"testing"
 )
 
-func TestPerplexityWrapper(t *testing.T) {
+func TestPerplexityProvider(t *testing.T) {
 	promptText := "Please tell me about Perplexity"
 	quietMode = true
 
-	Render(PerplexityWrapper(promptText, true, false, quietMode))
+	response, duration, err := CompleteProvider(context.Background(), perplexityProvider{}, Request{Prompt: promptText, Mock: true}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	Render(FmtModelResponse(perplexityProvider{}.Name(), response, duration, quietMode))
 }
 
 func TestCallPerplexityAPIGeminiVersion(t *testing.T) {
@@ -75,7 +80,10 @@ func TestCallPerplexityAPIGeminiVersion(t *testing.T) {
 		// The mock response in CallPerplexityAPI is hardcoded and different
 		// from the one served by our httptest server. This test checks the
 		// hardcoded mock response.
-		result, _ := CallPerplexityAPI(prompt, true)
+		result, _, err := CallPerplexityAPI(context.Background(), NewPerplexityRequest(prompt, perplexityDefaultModel, false, DefaultPerplexityOptions()), true)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
 
 		if result == "" {
 			t.Fatal("Expected a non-empty mock response, got empty string")
@@ -83,7 +91,7 @@ func TestCallPerplexityAPIGeminiVersion(t *testing.T) {
 
 		// Deserialize the hardcoded mock response
 		var response PerplexityResponse
-		err := json.Unmarshal([]byte(result), &response)
+		err = json.Unmarshal([]byte(result), &response)
 		if err != nil {
 			t.Fatalf("Failed to unmarshal hardcoded mock JSON response: %v\nResponse was: %s", err, result)
 		}
@@ -108,3 +116,66 @@ func TestCallPerplexityAPIGeminiVersion(t *testing.T) {
 		}
 	})
 }
+
+func TestNewPerplexityRequest(t *testing.T) {
+	opts := DefaultPerplexityOptions()
+	opts.AllowDomains = []string{"go.dev"}
+	opts.DenyDomains = []string{"example.com"}
+	opts.Recency = ""
+	opts.RelatedQuestions = true
+
+	// Quotes and newlines used to break the hand-built JSON
+	prompt := "What does \"go vet\" do?\nBe brief"
+	payload, err := json.Marshal(NewPerplexityRequest(prompt, perplexityDefaultModel, false, opts))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var request map[string]any
+	if err := json.Unmarshal(payload, &request); err != nil {
+		t.Fatalf("Invalid JSON %s: %v", payload, err)
+	}
+
+	messages := request["messages"].([]any)
+	if len(messages) != 2 || messages[1].(map[string]any)["content"] != prompt {
+		t.Errorf("Unexpected messages %v", messages)
+	}
+	if got := request["search_domain_filter"].([]any); len(got) != 2 || got[0] != "go.dev" || got[1] != "-example.com" {
+		t.Errorf("Unexpected search_domain_filter %v", got)
+	}
+	if _, ok := request["search_recency_filter"]; ok {
+		t.Error("Expected no search_recency_filter when recency is empty")
+	}
+	if request["return_related_questions"] != true {
+		t.Error("Expected return_related_questions to be true")
+	}
+}
+
+func TestPerplexityOptionsValidate(t *testing.T) {
+	if err := DefaultPerplexityOptions().Validate(); err != nil {
+		t.Errorf("Default options should be valid: %v", err)
+	}
+
+	opts := DefaultPerplexityOptions()
+	opts.Recency = "fortnight"
+	if err := opts.Validate(); err == nil {
+		t.Error("Expected an error for recency fortnight")
+	}
+}
+
+func TestParsePerplexityResponseExtras(t *testing.T) {
+	response, err := ParsePerplexityResponse(`{
+		"model": "sonar-pro",
+		"images": [{"image_url": "https://example.com/gopher.png", "origin_url": "https://example.com"}],
+		"related_questions": ["What is a goroutine?"],
+		"choices": [{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "Gophers."}}]
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := FmtModelResponse("Perplexity", response, 0, true)
+	if !strings.Contains(out, "- What is a goroutine?") || !strings.Contains(out, "1. https://example.com/gopher.png") {
+		t.Errorf("Expected related questions and images in output, got %q", out)
+	}
+}
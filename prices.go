@@ -0,0 +1,102 @@
+package main
+
+import (
+	"strings"
+)
+
+// ModelPrice is what a model costs in USD per million tokens
+type ModelPrice struct {
+	Input  float64 `toml:"input" json:"input"`
+	Output float64 `toml:"output" json:"output"`
+	// Cached is the price of cached input, the same as Input if not set
+	Cached float64 `toml:"cached,omitempty" json:"cached,omitempty"`
+}
+
+// defaultPrices are list prices when written, keyed by model name or the
+// start of one; the prices table in the config overrides and adds to them
+var defaultPrices = map[string]ModelPrice{
+	"gpt-4o":              {Input: 2.50, Output: 10, Cached: 1.25},
+	"gpt-4o-mini":         {Input: 0.15, Output: 0.60, Cached: 0.075},
+	"gpt-4.1":             {Input: 2, Output: 8, Cached: 0.50},
+	"gpt-4.1-mini":        {Input: 0.40, Output: 1.60, Cached: 0.10},
+	"gpt-4.1-nano":        {Input: 0.10, Output: 0.40, Cached: 0.025},
+	"o3":                  {Input: 2, Output: 8, Cached: 0.50},
+	"o3-mini":             {Input: 1.10, Output: 4.40, Cached: 0.55},
+	"o4-mini":             {Input: 1.10, Output: 4.40, Cached: 0.275},
+	"claude-opus-4":       {Input: 15, Output: 75, Cached: 1.50},
+	"claude-sonnet-4":     {Input: 3, Output: 15, Cached: 0.30},
+	"claude-3-7-sonnet":   {Input: 3, Output: 15, Cached: 0.30},
+	"claude-3-5-sonnet":   {Input: 3, Output: 15, Cached: 0.30},
+	"claude-3-5-haiku":    {Input: 0.80, Output: 4, Cached: 0.08},
+	"gemini-2.5-pro":      {Input: 1.25, Output: 10, Cached: 0.31},
+	"gemini-2.5-flash":    {Input: 0.30, Output: 2.50, Cached: 0.075},
+	"gemini-2.0-flash":    {Input: 0.10, Output: 0.40, Cached: 0.025},
+	"gemini-1.5-pro":      {Input: 1.25, Output: 5},
+	"gemini-1.5-flash":    {Input: 0.075, Output: 0.30},
+	"sonar":               {Input: 1, Output: 1},
+	"sonar-pro":           {Input: 3, Output: 15},
+	"sonar-reasoning":     {Input: 1, Output: 5},
+	"sonar-reasoning-pro": {Input: 2, Output: 8},
+	"sonar-deep-research": {Input: 2, Output: 8},
+	"llama-4-scout":       {Input: 0.65, Output: 0.85},
+	"llama-3.3-70b":       {Input: 0.85, Output: 1.20},
+	"llama3.1-8b":         {Input: 0.10, Output: 0.10},
+}
+
+// PriceTable returns the price table, the defaults with the config's on top
+func (cfg Config) PriceTable() map[string]ModelPrice {
+	prices := make(map[string]ModelPrice, len(defaultPrices)+len(cfg.Prices))
+	for model, price := range defaultPrices {
+		prices[model] = price
+	}
+	for model, price := range cfg.Prices {
+		prices[strings.ToLower(model)] = price
+	}
+	return prices
+}
+
+// LookupPrice finds the price of model in prices, by the longest name which
+// starts it, so gpt-4o-2024-08-06 is priced as gpt-4o and gpt-4o-mini as
+// itself. Gemini's models/ prefix is ignored
+func LookupPrice(prices map[string]ModelPrice, model string) (ModelPrice, bool) {
+	model = strings.TrimPrefix(strings.ToLower(model), "models/")
+
+	var best string
+	for name := range prices {
+		if strings.HasPrefix(model, name) && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return ModelPrice{}, false
+	}
+	return prices[best], true
+}
+
+// EntryCost estimates what the call logged in entry cost in USD, and is
+// false if we don't know the price of its model. Local providers are free.
+// Entries from before the split of tokens was logged have only the total,
+// which is costed at the mean of the input and output prices
+func EntryCost(prices map[string]ModelPrice, entry LogEntry) (float64, bool) {
+	if p, ok := LookupProvider(entry.Provider); ok && p.Capabilities().Local {
+		return 0, true
+	}
+
+	price, ok := LookupPrice(prices, entry.ModelName)
+	if !ok {
+		return 0, false
+	}
+
+	if entry.PromptTokens == 0 && entry.CompletionTokens == 0 {
+		return float64(entry.TotalTokens) * (price.Input + price.Output) / 2 / 1e6, true
+	}
+
+	cached := price.Cached
+	if cached == 0 {
+		cached = price.Input
+	}
+	cost := float64(entry.PromptTokens-entry.CachedTokens)*price.Input +
+		float64(entry.CachedTokens)*cached +
+		float64(entry.CompletionTokens)*price.Output
+	return cost / 1e6, true
+}
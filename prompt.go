@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Where a part of the prompt came from
+const (
+	SourceArgs  = "args"
+	SourceStdin = "stdin"
+)
+
+// PromptSource records which bytes of a prompt came from where
+type PromptSource struct {
+	Source string `json:"source"`
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+	// Path names the file for context sources
+	Path string `json:"path,omitempty"`
+}
+
+// BuildPrompt combines the instruction given as arguments with the document
+// piped on stdin. Either may be empty. The document is wrapped in tags so the
+// model can tell where it starts and ends and doesn't take it as instructions
+func BuildPrompt(instruction string, document string) (string, []PromptSource) {
+	instruction = strings.TrimSpace(instruction)
+	document = strings.TrimSpace(document)
+
+	switch {
+	case document == "":
+		return instruction, []PromptSource{{Source: SourceArgs, Start: 0, End: len(instruction)}}
+	case instruction == "":
+		return document, []PromptSource{{Source: SourceStdin, Start: 0, End: len(document)}}
+	}
+
+	var builder strings.Builder
+	builder.WriteString(instruction)
+	instructionEnd := builder.Len()
+
+	fmt.Fprintf(&builder, "\n\n<%s>\n", SourceStdin)
+	documentStart := builder.Len()
+	builder.WriteString(document)
+	documentEnd := builder.Len()
+	fmt.Fprintf(&builder, "\n</%s>", SourceStdin)
+
+	return builder.String(), []PromptSource{
+		{Source: SourceArgs, Start: 0, End: instructionEnd},
+		{Source: SourceStdin, Start: documentStart, End: documentEnd},
+	}
+}
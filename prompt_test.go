@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestBuildPrompt(t *testing.T) {
+	prompt, sources := BuildPrompt("Summarize this text", "It was a dark and stormy night.\n")
+
+	want := "Summarize this text\n\n<stdin>\nIt was a dark and stormy night.\n</stdin>"
+	if prompt != want {
+		t.Errorf("Expected %q, got %q", want, prompt)
+	}
+
+	if len(sources) != 2 {
+		t.Fatalf("Expected 2 sources, got %v", sources)
+	}
+	if got := prompt[sources[0].Start:sources[0].End]; sources[0].Source != SourceArgs || got != "Summarize this text" {
+		t.Errorf("Unexpected args source %v: %q", sources[0], got)
+	}
+	if got := prompt[sources[1].Start:sources[1].End]; sources[1].Source != SourceStdin || got != "It was a dark and stormy night." {
+		t.Errorf("Unexpected stdin source %v: %q", sources[1], got)
+	}
+}
+
+func TestBuildPromptOneSource(t *testing.T) {
+	if prompt, sources := BuildPrompt("Hello", ""); prompt != "Hello" || sources[0].Source != SourceArgs {
+		t.Errorf("Unexpected prompt %q from %v", prompt, sources)
+	}
+	if prompt, sources := BuildPrompt("", " Hello\n"); prompt != "Hello" || sources[0].Source != SourceStdin {
+		t.Errorf("Unexpected prompt %q from %v", prompt, sources)
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Request is what we send to a provider
+type Request struct {
+	Prompt string
+	// History is the conversation before Prompt, alternating user and
+	// assistant messages
+	History []Message
+	// Sources says where the parts of Prompt came from, for the log
+	Sources []PromptSource
+	// Model overrides the provider's default model if set
+	Model string
+	// System is the system prompt, if any, sent however the API takes it
+	System string
+	// Params are sampling parameters, limited to those the provider supports
+	Params GenerationParams
+	// Session and Turn place the request in a conversation, for the log
+	Session string
+	Turn    int
+	// Mock asks the provider for a canned response rather than calling the API
+	Mock bool
+}
+
+// ModelOr returns the requested model, or def if none was requested
+func (req Request) ModelOr(def string) string {
+	if req.Model != "" {
+		return req.Model
+	}
+	return def
+}
+
+// Messages returns the chat messages for APIs which take the system prompt as
+// a message: the system prompt, if any, the history and then the prompt
+func (req Request) Messages() []Message {
+	var messages []Message
+	if req.System != "" {
+		messages = append(messages, Message{Role: "system", Content: req.System})
+	}
+	return append(messages, req.Conversation()...)
+}
+
+// Conversation returns the history followed by the prompt, for APIs which
+// take the system prompt separately
+func (req Request) Conversation() []Message {
+	messages := append([]Message{}, req.History...)
+	return append(messages, Message{Role: "user", Content: req.Prompt})
+}
+
+// Capabilities describes the optional things a provider can do
+type Capabilities struct {
+	// ListModels is true if the provider implements ModelLister
+	ListModels bool
+	// Citations is true if responses come back with source citations
+	Citations bool
+	// Local is true if the provider runs on this machine, so it needs no
+	// internet connection and is only used when explicitly selected
+	Local bool
+	// Stream is true if the provider implements Streamer
+	Stream bool
+	// Params are the generation params the provider accepts
+	Params ParamSupport
+}
+
+// Provider is a single LLM backend
+type Provider interface {
+	// Name is the display name, e.g. "ChatGPT"
+	Name() string
+	// Flag is the short command line flag without the dash, e.g. "c"
+	Flag() string
+	// EnvKey is the environment variable holding the API key, or "" if the
+	// provider doesn't need one
+	EnvKey() string
+	Capabilities() Capabilities
+	Complete(ctx context.Context, req Request) (ModelResponse, error)
+}
+
+// ModelLister is implemented by providers which can list their models
+type ModelLister interface {
+	ListModels(ctx context.Context) (string, error)
+}
+
+// SystemPrompter is implemented by providers with a system prompt of their
+// own, which is used unless one is given on the command line
+type SystemPrompter interface {
+	SystemPrompt() string
+}
+
+// Streamer is implemented by providers which can hand back tokens as they
+// arrive; the returned response holds the assembled content
+type Streamer interface {
+	Stream(ctx context.Context, req Request, onToken func(string)) (ModelResponse, error)
+}
+
+// registry holds providers in the order they were registered
+var registry []Provider
+
+// reservedFlags are taken by options, so providers can't use them
+var reservedFlags = []string{"h", "t", "l", "q", "rl"}
+
+// RegisterProvider adds a provider to the registry, normally from an init()
+func RegisterProvider(p Provider) {
+	if err := registerProvider(p); err != nil {
+		panic(err)
+	}
+}
+
+func registerProvider(p Provider) error {
+	if strSliceContains(reservedFlags, p.Flag()) || strings.HasPrefix(p.Flag(), "l") {
+		return fmt.Errorf("provider %s can't use the flag -%s as it is taken by an option", p.Name(), p.Flag())
+	}
+	for _, each := range registry {
+		if strings.EqualFold(each.Name(), p.Name()) {
+			return fmt.Errorf("provider %s registered twice", p.Name())
+		}
+		if each.Flag() == p.Flag() {
+			return fmt.Errorf("providers %s and %s share the flag -%s", each.Name(), p.Name(), p.Flag())
+		}
+	}
+	registry = append(registry, p)
+	return nil
+}
+
+// FindProviderByFlag returns the provider whose flag, with prefix, is arg
+func FindProviderByFlag(arg string, prefix string) (Provider, bool) {
+	for _, p := range registry {
+		if arg == prefix+p.Flag() {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// Providers returns all registered providers
+func Providers() []Provider {
+	return registry
+}
+
+// LookupProvider finds a provider by name, ignoring case
+func LookupProvider(name string) (Provider, bool) {
+	for _, p := range registry {
+		if strings.EqualFold(p.Name(), name) {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// GetAPIKey returns the API key for the provider, or "" if not set
+func GetAPIKey(p Provider) string {
+	if p.EnvKey() == "" {
+		return ""
+	}
+	return os.Getenv(p.EnvKey())
+}
+
+// HaveAPIKey is true if the provider doesn't need a key or the key is set
+func HaveAPIKey(p Provider) bool {
+	return p.EnvKey() == "" || GetAPIKey(p) != ""
+}
+
+// RequireAPIKey returns the API key held in envKey, or an error if it isn't set
+func RequireAPIKey(envKey string) (string, error) {
+	ret := os.Getenv(envKey)
+	if ret == "" {
+		return "", fmt.Errorf("%s is not set", envKey)
+	}
+	return ret, nil
+}
+
+// fmtTokens formats the tokens used for the status line, with the split if
+// the provider gave it
+func fmtTokens(response ModelResponse) string {
+	out := fmt.Sprintf("%d tokens used", response.TotalTokens)
+	if response.PromptTokens == 0 && response.CompletionTokens == 0 {
+		return out
+	}
+
+	out += fmt.Sprintf(" (%d in", response.PromptTokens)
+	if response.CachedTokens > 0 {
+		out += fmt.Sprintf(" of which %d cached", response.CachedTokens)
+	}
+	out += fmt.Sprintf(", %d out", response.CompletionTokens)
+	if response.ReasoningTokens > 0 {
+		out += fmt.Sprintf(" of which %d reasoning", response.ReasoningTokens)
+	}
+	return out + ")"
+}
+
+// FmtModelResponse formats a response for rendering, with a status line and
+// any citations as markdown footnotes
+func FmtModelResponse(name string, response ModelResponse, duration time.Duration, quietMode bool) string {
+	var out string
+
+	if !quietMode {
+		out += fmt.Sprintf("# %s\n\n", name)
+		out += fmt.Sprintf("Model: %s, %s, finished due to: %s, ", response.Model, fmtTokens(response), response.FinishReason)
+		if response.SafetyRating != "" {
+			out += fmt.Sprintf("safety rating: %s, ", response.SafetyRating)
+		}
+		out += fmt.Sprintf("duration: %.3f seconds\n", duration.Seconds())
+	}
+
+	if len(response.Citations) == 0 {
+		return out + fmt.Sprintf("\n%s\n\n", response.Content) + fmtSearchExtras(response)
+	}
+
+	// Replace e.g. [1] with [^1] in response.Content using a regex
+	re := regexp.MustCompile(`\[(\d+)\]`)
+	formattedContent := re.ReplaceAllString(response.Content, "[^$1]")
+
+	out += fmt.Sprintf("\n%s\n\n", formattedContent)
+
+	// Markdown citations
+	for idx, citation := range response.Citations {
+		out += fmt.Sprintf("[^%d]: %s\n", idx+1, citation)
+	}
+
+	out += "\n\nCitations:\n\n"
+
+	// Non-markdown citations
+	for idx, citation := range response.Citations {
+		out += fmt.Sprintf("%d. %s\n", idx+1, citation)
+	}
+
+	return out + "\n" + fmtSearchExtras(response)
+}
+
+// fmtSearchExtras formats the related questions and images some search
+// providers return alongside the answer
+func fmtSearchExtras(response ModelResponse) string {
+	var out string
+
+	if len(response.RelatedQuestions) > 0 {
+		out += "Related questions:\n\n"
+		for _, question := range response.RelatedQuestions {
+			out += fmt.Sprintf("- %s\n", question)
+		}
+		out += "\n"
+	}
+
+	if len(response.Images) > 0 {
+		out += "Images:\n\n"
+		for idx, image := range response.Images {
+			out += fmt.Sprintf("%d. %s\n", idx+1, image)
+		}
+		out += "\n"
+	}
+
+	return out
+}
+
+// CompleteProvider calls the provider, retrying as need be, and logs the
+// interaction if logging is enabled
+func CompleteProvider(ctx context.Context, p Provider, req Request, logToJsonl bool) (ModelResponse, time.Duration, error) {
+	fromTime := time.Now()
+
+	var response ModelResponse
+	stats, err := Retry(ctx, retryPolicy, func() error {
+		var err error
+		response, err = p.Complete(ctx, req)
+		return err
+	})
+	if cause := cancelCause(ctx); err != nil && cause != nil {
+		// There's no answer but the prompt is worth keeping
+		if logToJsonl {
+			logModelCall(p, req, ModelResponse{Model: req.Model, FinishReason: StopReasonCancelled}, time.Since(fromTime), stats)
+		}
+		return ModelResponse{}, 0, cause
+	}
+	if err != nil {
+		return ModelResponse{}, 0, err
+	}
+
+	duration := time.Since(fromTime)
+
+	// Log successful model call only if logging is enabled
+	if logToJsonl {
+		logModelCall(p, req, response, duration, stats)
+	}
+
+	return response, duration, nil
+}
+
+// logModelCall writes a model call to the log; failures are reported but
+// don't fail the request
+func logModelCall(p Provider, req Request, response ModelResponse, duration time.Duration, stats RetryStats) {
+	logEntry := LogEntry{
+		Provider:         p.Name(),
+		SessionID:        req.Session,
+		Turn:             req.Turn,
+		ModelName:        response.Model,
+		TotalTokens:      response.TotalTokens,
+		PromptTokens:     response.PromptTokens,
+		CompletionTokens: response.CompletionTokens,
+		CachedTokens:     response.CachedTokens,
+		ReasoningTokens:  response.ReasoningTokens,
+		Duration:         duration.Seconds(),
+		StopReason:       response.FinishReason,
+		SystemPrompt:     req.System,
+		Params:           req.Params,
+		PromptText:       req.Prompt,
+		PromptSources:    req.Sources,
+		ModelResponse:    response.Content,
+		Images:           response.Images,
+		RelatedQuestions: response.RelatedQuestions,
+		Timestamp:        time.Now(),
+		Retries:          stats.Retries,
+		RetryWait:        stats.Wait.Seconds(),
+	}
+	if err := WriteLogEntry(logEntry); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write log entry: %v\n", err)
+	}
+}
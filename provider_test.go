@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLookupProvider(t *testing.T) {
+	for _, name := range []string{"ChatGPT", "gemini", "CEREBRAS", "Perplexity"} {
+		if _, ok := LookupProvider(name); !ok {
+			t.Errorf("Expected provider %s to be registered", name)
+		}
+	}
+
+	if _, ok := LookupProvider("nonesuch"); ok {
+		t.Error("Expected no provider called nonesuch")
+	}
+}
+
+func TestFmtModelResponseCitations(t *testing.T) {
+	response := ModelResponse{
+		Model:     "mock",
+		Content:   "Some claim[1]",
+		Citations: []string{"https://example.com"},
+	}
+
+	out := FmtModelResponse("Mock", response, 0, true)
+	if !strings.Contains(out, "Some claim[^1]") {
+		t.Errorf("Expected citation to become a footnote, got %s", out)
+	}
+	if !strings.Contains(out, "[^1]: https://example.com") {
+		t.Errorf("Expected footnote definition, got %s", out)
+	}
+}
+
+func TestFmtTokens(t *testing.T) {
+	if got := fmtTokens(ModelResponse{TotalTokens: 30}); got != "30 tokens used" {
+		t.Errorf("Unexpected %q without the split", got)
+	}
+
+	response := ModelResponse{TotalTokens: 30, PromptTokens: 20, CachedTokens: 15, CompletionTokens: 10, ReasoningTokens: 4}
+	if got := fmtTokens(response); got != "30 tokens used (20 in of which 15 cached, 10 out of which 4 reasoning)" {
+		t.Errorf("Unexpected %q with the split", got)
+	}
+}
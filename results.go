@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Result is the outcome of one provider's part in a fan-out
+type Result struct {
+	Provider Provider
+	Err      error
+}
+
+// ValidateFailOn checks a --fail-on value, which is "any", "all", "none" or a
+// comma separated list of provider names
+func ValidateFailOn(failOn string) error {
+	switch failOn {
+	case "any", "all", "none":
+		return nil
+	}
+
+	for _, name := range strings.Split(failOn, ",") {
+		if _, ok := LookupProvider(strings.TrimSpace(name)); !ok {
+			return fmt.Errorf("--fail-on should be any, all, none or provider names, not %q", name)
+		}
+	}
+	return nil
+}
+
+// FailedResults returns only the results which failed
+func FailedResults(results []Result) []Result {
+	var failed []Result
+	for _, r := range results {
+		if r.Err != nil {
+			failed = append(failed, r)
+		}
+	}
+	return failed
+}
+
+// PrintFailures writes a summary of the failed providers
+func PrintFailures(w io.Writer, results []Result) {
+	failed := FailedResults(results)
+	if len(failed) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "\n%d of %d providers failed:\n", len(failed), len(results))
+	for _, r := range failed {
+		fmt.Fprintf(w, " - %s: %v\n", r.Provider.Name(), r.Err)
+	}
+}
+
+// ExitCode is 1 if the failures are ones failOn says we care about, else 0
+func ExitCode(results []Result, failOn string) int {
+	failed := FailedResults(results)
+
+	switch failOn {
+	case "none":
+		return 0
+	case "any":
+		if len(failed) > 0 {
+			return 1
+		}
+		return 0
+	case "all":
+		if len(results) > 0 && len(failed) == len(results) {
+			return 1
+		}
+		return 0
+	}
+
+	// impliedly failOn is a list of providers we care about
+	for _, name := range strings.Split(failOn, ",") {
+		for _, r := range failed {
+			if strings.EqualFold(r.Provider.Name(), strings.TrimSpace(name)) {
+				return 1
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	results := []Result{
+		{Provider: chatGPTProvider{}},
+		{Provider: geminiProvider{}, Err: errors.New("boom")},
+	}
+
+	cases := map[string]int{
+		"any":             1,
+		"all":             0,
+		"none":            0,
+		"chatgpt":         0,
+		"gemini":          1,
+		"chatgpt, Gemini": 1,
+	}
+	for failOn, want := range cases {
+		if got := ExitCode(results, failOn); got != want {
+			t.Errorf("ExitCode(%q) = %d, want %d", failOn, got, want)
+		}
+	}
+}
+
+func TestValidateFailOn(t *testing.T) {
+	for _, ok := range []string{"any", "all", "none", "gemini", "chatgpt,perplexity"} {
+		if err := ValidateFailOn(ok); err != nil {
+			t.Errorf("ValidateFailOn(%q) = %v", ok, err)
+		}
+	}
+	if err := ValidateFailOn("nope"); err == nil {
+		t.Error("Expected an error for an unknown provider")
+	}
+}
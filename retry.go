@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/openai/openai-go"
+	"google.golang.org/api/googleapi"
+)
+
+// RetryPolicy says how often and how patiently we retry a failed call
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	// MaxDelay caps any single wait, including one asked for by Retry-After
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy is used unless --retries says otherwise
+var DefaultRetryPolicy = RetryPolicy{MaxRetries: 3, BaseDelay: 500 * time.Millisecond, MaxDelay: 60 * time.Second}
+
+// retryPolicy is shared by all providers, like quietMode
+var retryPolicy = DefaultRetryPolicy
+
+// RetryStats records what retrying cost us, for the log
+type RetryStats struct {
+	Retries int
+	Wait    time.Duration
+}
+
+// HTTPStatusError is returned by the providers which talk HTTP themselves
+// when the server doesn't reply 200, so that we can tell what's worth retrying
+type HTTPStatusError struct {
+	StatusCode int
+	Status     string
+	Header     http.Header
+	Message    string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Status, e.Message)
+}
+
+// permanentError marks an error which mustn't be retried whatever it is
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so that Retry gives up on it straight away
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// Retry calls fn until it succeeds, fails with something not worth retrying,
+// or we run out of retries. Waits grow exponentially with jitter, unless the
+// server tells us how long to wait with Retry-After
+func Retry(ctx context.Context, policy RetryPolicy, fn func() error) (RetryStats, error) {
+	var stats RetryStats
+
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= policy.MaxRetries {
+			return stats, err
+		}
+
+		retryable, retryAfter := classifyError(err)
+		if !retryable {
+			return stats, err
+		}
+
+		wait := backoff(policy, attempt, retryAfter)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return stats, err
+		case <-timer.C:
+		}
+
+		stats.Retries++
+		stats.Wait += wait
+	}
+}
+
+// backoff is how long to wait before retry number attempt+1
+func backoff(policy RetryPolicy, attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return min(retryAfter, policy.MaxDelay)
+	}
+
+	// Full exponential delay, less up to half of it at random so that
+	// everybody who was rate limited at once doesn't come back at once
+	delay := min(policy.BaseDelay<<attempt, policy.MaxDelay)
+	if delay <= 0 {
+		return 0
+	}
+	return delay - rand.N(delay/2+1)
+}
+
+// classifyError says whether err is worth retrying and how long the server
+// asked us to wait, if it did
+func classifyError(err error) (bool, time.Duration) {
+	var permanent *permanentError
+	if errors.As(err, &permanent) {
+		return false, 0
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false, 0
+	}
+
+	var statusCode int
+	var header http.Header
+
+	var httpErr *HTTPStatusError
+	var openaiErr *openai.Error
+	var googleErr *googleapi.Error
+
+	switch {
+	case errors.As(err, &httpErr):
+		statusCode, header = httpErr.StatusCode, httpErr.Header
+	case errors.As(err, &openaiErr):
+		statusCode = openaiErr.StatusCode
+		if openaiErr.Response != nil {
+			header = openaiErr.Response.Header
+		}
+	case errors.As(err, &googleErr):
+		statusCode, header = googleErr.Code, googleErr.Header
+	default:
+		return false, 0
+	}
+
+	if !retryableStatus(statusCode) {
+		return false, 0
+	}
+	return true, parseRetryAfter(header, time.Now())
+}
+
+// retryableStatus is true for rate limiting and server errors, which tend to
+// go away; anything else will fail the same way next time
+func retryableStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+// parseRetryAfter reads Retry-After, which is either seconds or a date, and
+// OpenAI's retry-after-ms
+func parseRetryAfter(header http.Header, now time.Time) time.Duration {
+	if header == nil {
+		return 0
+	}
+
+	if ms, err := strconv.ParseFloat(header.Get("Retry-After-Ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if when, err := http.ParseTime(value); err == nil && when.After(now) {
+		return when.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+var testRetryPolicy = RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+
+func TestRetryTransient(t *testing.T) {
+	calls := 0
+	stats, err := Retry(context.Background(), testRetryPolicy, func() error {
+		calls++
+		if calls < 3 {
+			return &HTTPStatusError{StatusCode: http.StatusServiceUnavailable, Status: "503 Service Unavailable"}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 || stats.Retries != 2 {
+		t.Errorf("Expected 3 calls and 2 retries, got %d and %d", calls, stats.Retries)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	cases := map[string]error{
+		"bad request": &HTTPStatusError{StatusCode: http.StatusBadRequest, Status: "400 Bad Request"},
+		"permanent":   Permanent(&HTTPStatusError{StatusCode: http.StatusTooManyRequests, Status: "429 Too Many Requests"}),
+		"other":       errors.New("no idea"),
+	}
+	for name, want := range cases {
+		calls := 0
+		_, err := Retry(context.Background(), testRetryPolicy, func() error {
+			calls++
+			return want
+		})
+		if calls != 1 || !errors.Is(err, want) {
+			t.Errorf("%s: expected one call returning %v, got %d calls returning %v", name, want, calls, err)
+		}
+	}
+
+	calls := 0
+	stats, _ := Retry(context.Background(), testRetryPolicy, func() error {
+		calls++
+		return &HTTPStatusError{StatusCode: http.StatusTooManyRequests, Status: "429 Too Many Requests"}
+	})
+	if calls != testRetryPolicy.MaxRetries+1 || stats.Retries != testRetryPolicy.MaxRetries {
+		t.Errorf("Expected %d retries, got %d calls and %d retries", testRetryPolicy.MaxRetries, calls, stats.Retries)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 4, 24, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		header http.Header
+		want   time.Duration
+	}{
+		{http.Header{"Retry-After": {"2"}}, 2 * time.Second},
+		{http.Header{"Retry-After": {now.Add(5 * time.Second).Format(http.TimeFormat)}}, 5 * time.Second},
+		{http.Header{"Retry-After-Ms": {"250"}, "Retry-After": {"1"}}, 250 * time.Millisecond},
+		{http.Header{"Retry-After": {"soon"}}, 0},
+		{nil, 0},
+	}
+	for _, c := range cases {
+		if got := parseRetryAfter(c.header, now); got != c.want {
+			t.Errorf("parseRetryAfter(%v) = %v, want %v", c.header, got, c.want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	for attempt := range 6 {
+		full := min(policy.BaseDelay<<attempt, policy.MaxDelay)
+		got := backoff(policy, attempt, 0)
+		if got < full/2 || got > full {
+			t.Errorf("backoff(%d) = %v, want between %v and %v", attempt, got, full/2, full)
+		}
+	}
+
+	if got := backoff(policy, 0, 5*time.Second); got != policy.MaxDelay {
+		t.Errorf("Expected Retry-After to be capped at %v, got %v", policy.MaxDelay, got)
+	}
+}
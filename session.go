@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// NewSessionID returns a new conversation ID for the log
+func NewSessionID() string {
+	return uuid.NewString()
+}
+
+// Session is a conversation rebuilt from the log
+type Session struct {
+	ID string
+	// Turns is the number of the last turn
+	Turns int
+	// Providers are those which took part, in the order they first answered
+	Providers []string
+	// Histories and Models are keyed by provider name
+	Histories map[string][]Message
+	Models    map[string]string
+}
+
+// FindSession returns the ID of the session in entries which starts with
+// prefix, which has to be unique
+func FindSession(entries []LogEntry, prefix string) (string, error) {
+	var found string
+	for _, entry := range entries {
+		if entry.SessionID == "" || !strings.HasPrefix(entry.SessionID, prefix) || entry.SessionID == found {
+			continue
+		}
+		if found != "" {
+			return "", fmt.Errorf("more than one session starts with %s", prefix)
+		}
+		found = entry.SessionID
+	}
+
+	if found == "" {
+		return "", fmt.Errorf("no session starts with %s", prefix)
+	}
+	return found, nil
+}
+
+// LoadSession rebuilds the conversation with the ID id from entries. Calls
+// which were cancelled are left out, so each history alternates between the
+// user and the provider
+func LoadSession(entries []LogEntry, id string) Session {
+	var turns []LogEntry
+	for _, entry := range entries {
+		if entry.SessionID == id {
+			turns = append(turns, entry)
+		}
+	}
+	sort.SliceStable(turns, func(i int, j int) bool {
+		if turns[i].Turn != turns[j].Turn {
+			return turns[i].Turn < turns[j].Turn
+		}
+		return turns[i].Timestamp.Before(turns[j].Timestamp)
+	})
+
+	return buildSession(id, turns)
+}
+
+// LookupSession returns the ID of the session in the log which starts with
+// prefix, which has to be unique. The log is streamed, holding on to an
+// entry from each of no more than two matching sessions
+func LookupSession(prefix string) (string, error) {
+	var matches []LogEntry
+	err := ScanLog(func(entry LogEntry) {
+		if len(matches) == 2 || entry.SessionID == "" || !strings.HasPrefix(entry.SessionID, prefix) {
+			return
+		}
+		if len(matches) == 0 || matches[0].SessionID != entry.SessionID {
+			entry.PromptText, entry.ModelResponse = "", ""
+			matches = append(matches, entry)
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	return FindSession(matches, prefix)
+}
+
+// ReadSession rebuilds the conversation with the ID id from the log,
+// holding on to only its entries
+func ReadSession(id string) (Session, error) {
+	var turns []LogEntry
+	err := ScanLog(func(entry LogEntry) {
+		if entry.SessionID == id {
+			turns = append(turns, entry)
+		}
+	})
+	if err != nil {
+		return Session{}, err
+	}
+	return LoadSession(turns, id), nil
+}
+
+// SessionFromEntry returns the session of the log entry at idx in entries.
+// An entry from before sessions were logged starts
+// a new session with just that exchange
+func SessionFromEntry(entries []LogEntry, idx int) (Session, error) {
+	if idx < 0 || idx >= len(entries) {
+		return Session{}, fmt.Errorf("idx %d doesn't make sense when we have %d log entries", idx, len(entries))
+	}
+
+	entry := entries[idx]
+	if entry.SessionID != "" {
+		return LoadSession(entries, entry.SessionID), nil
+	}
+
+	entry.Turn = 1
+	return buildSession(NewSessionID(), []LogEntry{entry}), nil
+}
+
+// buildSession assembles the histories from turns, which are in order
+func buildSession(id string, turns []LogEntry) Session {
+	session := Session{ID: id, Histories: map[string][]Message{}, Models: map[string]string{}}
+
+	for _, entry := range turns {
+		session.Turns = max(session.Turns, entry.Turn)
+		if entry.StopReason == StopReasonCancelled {
+			continue
+		}
+
+		// Entries from before the provider was logged go by the model
+		provider := entry.Provider
+		if p, ok := ProviderForModel(entry.ModelName); provider == "" && ok {
+			provider = p.Name()
+		}
+
+		if _, ok := session.Histories[provider]; !ok {
+			session.Providers = append(session.Providers, provider)
+		}
+		session.Histories[provider] = append(session.Histories[provider],
+			Message{Role: "user", Content: entry.PromptText},
+			Message{Role: "assistant", Content: entry.ModelResponse},
+		)
+		session.Models[provider] = entry.ModelName
+	}
+
+	return session
+}
+
+// HistoryFor returns the history of the provider named name. If only one
+// provider took part, another can carry on from its history
+func (session Session) HistoryFor(name string) []Message {
+	if history, ok := session.Histories[name]; ok {
+		return history
+	}
+	if len(session.Providers) == 1 {
+		return session.Histories[session.Providers[0]]
+	}
+	return nil
+}
+
+// cmdResume sends a follow up to a conversation from the log, found by a
+// prefix of its session ID or with --entry by one of its entries. It takes
+// the same options as ask, and the providers and models default to those
+// of the session
+func cmdResume(cfg Config, args []string) error {
+	opts := newAskOptions()
+
+	fs, err := newAskFlags(&opts)
+	if err != nil {
+		return err
+	}
+	entryID := fs.String("entry", "", "resume the session of the log entry with this `id`, or a unique prefix of it")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if *entryID == "" && len(positional) == 0 {
+		return fmt.Errorf("usage: %s resume <session> [options] [prompt], or resume --entry <id>", os.Args[0])
+	}
+
+	var session Session
+	if *entryID != "" {
+		entry, err := LookupLogEntry(*entryID)
+		if err != nil {
+			return err
+		}
+		if entry.SessionID == "" {
+			session, err = SessionFromEntry([]LogEntry{entry}, 0)
+		} else {
+			session, err = ReadSession(entry.SessionID)
+		}
+		if err != nil {
+			return err
+		}
+	} else {
+		id, err := LookupSession(positional[0])
+		if err != nil {
+			return err
+		}
+		if session, err = ReadSession(id); err != nil {
+			return err
+		}
+		positional = positional[1:]
+	}
+	if err := opts.resume(session); err != nil {
+		return err
+	}
+
+	if err := opts.prepare(cfg); err != nil {
+		return err
+	}
+	Print(fmt.Sprintf("Resuming session %s at turn %d", shortID(session.ID), opts.turn))
+
+	histories := map[string][]Message{}
+	for _, p := range opts.selected {
+		histories[p.Name()] = session.HistoryFor(p.Name())
+	}
+
+	return opts.askOnce(cfg, strings.Join(positional, " "), histories)
+}
+
+// resume sets opts to carry on session: its providers and models unless
+// the options say otherwise, and its next turn
+func (opts *askOptions) resume(session Session) error {
+	if len(session.Providers) == 0 {
+		return fmt.Errorf("session %s has no answers to carry on from", shortID(session.ID))
+	}
+
+	// Providers we couldn't tell from an entry from before the provider was
+	// logged are left to the default selection
+	if len(opts.selected) == 0 {
+		for _, name := range session.Providers {
+			if name == "" {
+				continue
+			}
+			p, ok := LookupProvider(name)
+			if !ok {
+				return fmt.Errorf("unknown provider %q in session %s, pick one with e.g. --provider", name, shortID(session.ID))
+			}
+			opts.selectProvider(p)
+		}
+	}
+
+	// Each provider keeps to its model unless --model says otherwise
+	if opts.models[""] == "" {
+		for name, model := range session.Models {
+			key := strings.ToLower(name)
+			if _, ok := opts.models[key]; !ok && key != "" {
+				opts.models[key] = model
+			}
+		}
+	}
+
+	// The context went with the first turn, and the log is where the
+	// session lives so the follow up goes there too
+	opts.noContext = true
+	opts.resumed = true
+	opts.session = session.ID
+	opts.turn = session.Turns + 1
+	return nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadSession(t *testing.T) {
+	start := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	// Newest first, as log list shows them
+	entries := []LogEntry{
+		{SessionID: "bbbb-2", Turn: 1, Provider: "Gemini", PromptText: "Other", ModelResponse: "Elsewhere", Timestamp: start.Add(4 * time.Minute)},
+		{SessionID: "aaaa-1", Turn: 3, Provider: "Anthropic", PromptText: "Stop", ModelResponse: "Partial", StopReason: StopReasonCancelled, Timestamp: start.Add(3 * time.Minute)},
+		{SessionID: "aaaa-1", Turn: 2, Provider: "Anthropic", ModelName: "claude-b", PromptText: "Second", ModelResponse: "Two", Timestamp: start.Add(2 * time.Minute)},
+		{SessionID: "aaaa-1", Turn: 1, Provider: "ChatGPT", ModelName: "gpt-a", PromptText: "First", ModelResponse: "One too", Timestamp: start.Add(time.Minute)},
+		{SessionID: "aaaa-1", Turn: 1, Provider: "Anthropic", ModelName: "claude-a", PromptText: "First", ModelResponse: "One", Timestamp: start},
+	}
+
+	id, err := FindSession(entries, "aaaa")
+	if err != nil || id != "aaaa-1" {
+		t.Fatalf("Expected to find aaaa-1, got %q (%v)", id, err)
+	}
+
+	session := LoadSession(entries, id)
+	if session.Turns != 3 {
+		t.Errorf("Expected 3 turns, got %d", session.Turns)
+	}
+	if len(session.Providers) != 2 || session.Providers[0] != "Anthropic" || session.Providers[1] != "ChatGPT" {
+		t.Errorf("Unexpected providers %q", session.Providers)
+	}
+
+	history := session.Histories["Anthropic"]
+	if len(history) != 4 || history[0].Content != "First" || history[3].Content != "Two" || history[3].Role != "assistant" {
+		t.Errorf("Expected two exchanges without the cancelled one, got %+v", history)
+	}
+	if session.Models["Anthropic"] != "claude-b" {
+		t.Errorf("Expected the latest model, got %q", session.Models["Anthropic"])
+	}
+	if session.HistoryFor("Gemini") != nil {
+		t.Error("Expected no history for a provider which didn't take part")
+	}
+}
+
+func TestReadSession(t *testing.T) {
+	logPath = filepath.Join(t.TempDir(), "gollm_logs.jsonl")
+	t.Cleanup(func() { logPath = "" })
+
+	start := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	entries := []LogEntry{
+		{SessionID: "aaaa-1", Turn: 1, Provider: "Anthropic", PromptText: "First", ModelResponse: "One", Timestamp: start},
+		{SessionID: "abbb-2", Turn: 1, Provider: "Gemini", PromptText: "Other", ModelResponse: "Elsewhere", Timestamp: start.Add(time.Minute)},
+		{SessionID: "aaaa-1", Turn: 2, Provider: "Anthropic", PromptText: "Second", ModelResponse: "Two", Timestamp: start.Add(2 * time.Minute)},
+	}
+	for _, entry := range entries {
+		if err := WriteLogEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	id, err := LookupSession("aa")
+	if err != nil || id != "aaaa-1" {
+		t.Fatalf("Expected to find aaaa-1, got %q (%v)", id, err)
+	}
+	if _, err := LookupSession("a"); err == nil {
+		t.Error("Expected an error for an ambiguous prefix")
+	}
+
+	session, err := ReadSession(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history := session.Histories["Anthropic"]; session.Turns != 2 || len(history) != 4 || history[3].Content != "Two" {
+		t.Errorf("Expected both turns of the session, got %+v", session)
+	}
+}
+
+func TestFindSessionErrors(t *testing.T) {
+	entries := []LogEntry{{SessionID: "abc-1"}, {SessionID: "abd-2"}, {}}
+
+	if _, err := FindSession(entries, "ab"); err == nil {
+		t.Error("Expected an error for an ambiguous prefix")
+	}
+	if _, err := FindSession(entries, "xyz"); err == nil {
+		t.Error("Expected an error for a missing session")
+	}
+}
+
+func TestSessionFromLegacyEntry(t *testing.T) {
+	entries := []LogEntry{{Provider: "Gemini", PromptText: "Hi", ModelResponse: "Hello"}}
+
+	session, err := SessionFromEntry(entries, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if session.ID == "" || session.Turns != 1 {
+		t.Errorf("Expected a new session at turn 1, got %+v", session)
+	}
+	// Another provider can carry on from a session with just one
+	if history := session.HistoryFor("ChatGPT"); len(history) != 2 || history[1].Content != "Hello" {
+		t.Errorf("Expected Gemini's history, got %+v", history)
+	}
+
+	if _, err := SessionFromEntry(entries, 1); err == nil {
+		t.Error("Expected an error for an index out of range")
+	}
+}
+
+func TestResumeLegacyEntry(t *testing.T) {
+	// Entries from before the provider was logged
+	entries := []LogEntry{
+		{ModelName: "claude-3-5-sonnet", PromptText: "Hi", ModelResponse: "Hello"},
+		{ModelName: "mystery", PromptText: "Hi", ModelResponse: "Hello"},
+	}
+
+	session, err := SessionFromEntry(entries, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := newAskOptions()
+	if err := opts.resume(session); err != nil {
+		t.Fatal(err)
+	}
+	if len(opts.selected) != 1 || opts.selected[0].Name() != "Anthropic" || opts.models["anthropic"] != "claude-3-5-sonnet" {
+		t.Errorf("Expected Anthropic from the model, got %v and %v", opts.selected, opts.models)
+	}
+	if history := session.HistoryFor("Anthropic"); len(history) != 2 || history[1].Content != "Hello" {
+		t.Errorf("Expected the entry's exchange, got %+v", history)
+	}
+
+	// Without a model we know, the default providers carry on
+	session, err = SessionFromEntry(entries, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts = newAskOptions()
+	if err := opts.resume(session); err != nil {
+		t.Fatal(err)
+	}
+	if len(opts.selected) != 0 || opts.turn != 2 {
+		t.Errorf("Expected the selection left to the defaults at turn 2, got %v at %d", opts.selected, opts.turn)
+	}
+	if history := session.HistoryFor("Gemini"); len(history) != 2 {
+		t.Errorf("Expected any provider to carry on, got %+v", history)
+	}
+}
+
+func TestResumeLogsWhenQuiet(t *testing.T) {
+	quietMode = true
+	t.Cleanup(func() { quietMode = false })
+
+	stderr := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	defer func() { os.Stderr = stderr }()
+
+	opts := newAskOptions()
+	opts.selectProvider(ollamaProvider{})
+	opts.resumed = true
+	if err := opts.prepare(DefaultConfig()); err != nil {
+		t.Fatal(err)
+	}
+	if !opts.logToJsonl {
+		t.Error("Expected a resumed session to be logged even when quiet")
+	}
+}
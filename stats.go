@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// StatsRow is the usage of one model or provider, in one period if the
+// stats are per day, week or month
+type StatsRow struct {
+	Period      string `json:"period,omitempty"`
+	Group       string `json:"group"`
+	Calls       int    `json:"calls"`
+	TotalTokens int    `json:"total_tokens"`
+	// The split of the total, from the entries which have it
+	PromptTokens     int            `json:"prompt_tokens"`
+	CompletionTokens int            `json:"completion_tokens"`
+	CachedTokens     int            `json:"cached_tokens"`
+	ReasoningTokens  int            `json:"reasoning_tokens"`
+	P50Duration      float64        `json:"p50_duration_seconds"`
+	P95Duration      float64        `json:"p95_duration_seconds"`
+	StopReasons      map[string]int `json:"stop_reasons"`
+	Cost             float64        `json:"cost_usd"`
+	// UnpricedCalls were to models we don't know the price of, so aren't
+	// in the cost
+	UnpricedCalls int `json:"unpriced_calls,omitempty"`
+
+	durations []float64
+}
+
+// add counts entry, which cost cost if priced
+func (row *StatsRow) add(entry LogEntry, cost float64, priced bool) {
+	row.Calls++
+	row.TotalTokens += entry.TotalTokens
+	row.PromptTokens += entry.PromptTokens
+	row.CompletionTokens += entry.CompletionTokens
+	row.CachedTokens += entry.CachedTokens
+	row.ReasoningTokens += entry.ReasoningTokens
+	row.durations = append(row.durations, entry.Duration)
+	row.StopReasons[entry.StopReason]++
+	if priced {
+		row.Cost += cost
+	} else {
+		row.UnpricedCalls++
+	}
+}
+
+// finish works out the percentiles once everything's been added
+func (row *StatsRow) finish() {
+	sort.Float64s(row.durations)
+	row.P50Duration = percentile(row.durations, 50)
+	row.P95Duration = percentile(row.durations, 95)
+}
+
+// percentile is the nearest rank percentile of sorted
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+// statsGroup is what an entry is grouped by: its model or provider
+func statsGroup(entry LogEntry, by string) string {
+	group := entry.ModelName
+	if by == "provider" {
+		group = entry.Provider
+	}
+	if group == "" {
+		return "(unknown)"
+	}
+	return group
+}
+
+// statsPeriod is the day, ISO week or month of t in local time, or "" for
+// stats over all time
+func statsPeriod(t time.Time, per string) string {
+	t = t.Local()
+	switch per {
+	case "day":
+		return t.Format("2006-01-02")
+	case "week":
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case "month":
+		return t.Format("2006-01")
+	}
+	return ""
+}
+
+// LogStats adds up the usage of the entries in the log matching filter, by
+// model or provider and per day, week, month or over all time. It returns
+// the rows, in order of period and then group, and the total
+func LogStats(filter LogFilter, by string, per string, prices map[string]ModelPrice) ([]StatsRow, StatsRow, error) {
+	rows := map[[2]string]*StatsRow{}
+	total := StatsRow{Group: "total", StopReasons: map[string]int{}}
+
+	err := ScanLogSince(filter.Since, func(entry LogEntry) {
+		if !filter.Match(entry) {
+			return
+		}
+
+		key := [2]string{statsPeriod(entry.Timestamp, per), statsGroup(entry, by)}
+		row, ok := rows[key]
+		if !ok {
+			row = &StatsRow{Period: key[0], Group: key[1], StopReasons: map[string]int{}}
+			rows[key] = row
+		}
+
+		cost, priced := EntryCost(prices, entry)
+		row.add(entry, cost, priced)
+		total.add(entry, cost, priced)
+	})
+	if err != nil {
+		return nil, StatsRow{}, err
+	}
+
+	sorted := make([]StatsRow, 0, len(rows))
+	for _, row := range rows {
+		row.finish()
+		sorted = append(sorted, *row)
+	}
+	sort.Slice(sorted, func(i int, j int) bool {
+		if sorted[i].Period != sorted[j].Period {
+			return sorted[i].Period < sorted[j].Period
+		}
+		return sorted[i].Group < sorted[j].Group
+	})
+	total.finish()
+
+	return sorted, total, nil
+}
+
+// formatStopReasons lists the stop reasons, most common first
+func formatStopReasons(reasons map[string]int) string {
+	var names []string
+	for name := range reasons {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i int, j int) bool {
+		if reasons[names[i]] != reasons[names[j]] {
+			return reasons[names[i]] > reasons[names[j]]
+		}
+		return names[i] < names[j]
+	})
+
+	var parts []string
+	for _, name := range names {
+		if name == "" {
+			parts = append(parts, fmt.Sprintf("none %d", reasons[name]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%s %d", name, reasons[name]))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// PrintStatsTable writes the rows and total as a table, with a period
+// column if they're per period
+func PrintStatsTable(w io.Writer, rows []StatsRow, total StatsRow, by string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	perPeriod := len(rows) > 0 && rows[0].Period != ""
+
+	header := strings.ToUpper(by) + "\tCALLS\tTOKENS\tIN\tOUT\tP50\tP95\tCOST\tSTOP REASONS"
+	if perPeriod {
+		header = "PERIOD\t" + header
+	}
+	fmt.Fprintln(tw, header)
+
+	unpriced := false
+	for _, row := range append(rows, total) {
+		cost := fmt.Sprintf("$%.4f", row.Cost)
+		if row.UnpricedCalls > 0 {
+			cost += "*"
+			unpriced = true
+		}
+		line := fmt.Sprintf("%s\t%d\t%d\t%d\t%d\t%.1fs\t%.1fs\t%s\t%s", row.Group, row.Calls, row.TotalTokens, row.PromptTokens, row.CompletionTokens, row.P50Duration, row.P95Duration, cost, formatStopReasons(row.StopReasons))
+		if perPeriod {
+			line = row.Period + "\t" + line
+		}
+		fmt.Fprintln(tw, line)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if unpriced {
+		calls := "calls"
+		if total.UnpricedCalls == 1 {
+			calls = "call"
+		}
+		fmt.Fprintf(w, "\n* leaves out %d %s to models without a price, see prices in the config\n", total.UnpricedCalls, calls)
+	}
+	return nil
+}
+
+// logStatsOptions are the flags of log stats
+type logStatsOptions struct {
+	filter LogFilter
+	by     string
+	per    string
+	json   bool
+}
+
+// addLogStatsFlags adds the flags of log stats, bar the filters
+func addLogStatsFlags(fs *flag.FlagSet, opts *logStatsOptions) {
+	fs.Func("by", "group by `model|provider`, default model", func(value string) error {
+		if value != "model" && value != "provider" {
+			return fmt.Errorf("--by should be model or provider, not %q", value)
+		}
+		opts.by = value
+		return nil
+	})
+	fs.Func("per", "break down per `day|week|month`, rather than over all time", func(value string) error {
+		if value != "day" && value != "week" && value != "month" {
+			return fmt.Errorf("--per should be day, week or month, not %q", value)
+		}
+		opts.per = value
+		return nil
+	})
+	fs.BoolVar(&opts.json, "json", false, "print the stats as JSON rather than a table")
+}
+
+// cmdLogStats prints the calls, tokens, durations, stop reasons and
+// estimated cost of the entries in the log which pass the filters
+func cmdLogStats(cfg Config, args []string) error {
+	opts := logStatsOptions{by: "model"}
+
+	fs := flag.NewFlagSet("log stats", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	addLogFilterFlags(fs, &opts.filter, time.Now())
+	addLogStatsFlags(fs, &opts)
+
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return fmt.Errorf("unexpected %q, see %s help", positional[0], os.Args[0])
+	}
+
+	rows, total, err := LogStats(opts.filter, opts.by, opts.per, cfg.PriceTable())
+	if err != nil {
+		return err
+	}
+
+	if opts.json {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(struct {
+			Rows  []StatsRow `json:"rows"`
+			Total StatsRow   `json:"total"`
+		}{rows, total})
+	}
+
+	if total.Calls == 0 {
+		fmt.Println("No log entries match")
+		return nil
+	}
+	return PrintStatsTable(os.Stdout, rows, total, opts.by)
+}
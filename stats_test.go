@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogStats(t *testing.T) {
+	logPath = filepath.Join(t.TempDir(), "gollm_logs.jsonl")
+	t.Cleanup(func() { logPath = "" })
+
+	day := time.Date(2025, 5, 1, 12, 0, 0, 0, time.Local)
+	entries := []LogEntry{
+		{Provider: "ChatGPT", ModelName: "gpt-4o-2024-08-06", TotalTokens: 1000, Duration: 1, StopReason: "stop", Timestamp: day},
+		{Provider: "ChatGPT", ModelName: "gpt-4o-2024-08-06", TotalTokens: 3000, Duration: 3, StopReason: "length", Timestamp: day},
+		{Provider: "ChatGPT", ModelName: "gpt-4o-2024-08-06", TotalTokens: 2000, Duration: 2, StopReason: "stop", Timestamp: day.AddDate(0, 0, 1)},
+		{Provider: "Ollama", ModelName: "llama3.2", TotalTokens: 500, Duration: 10, StopReason: "stop", Timestamp: day},
+		{Provider: "Groq", ModelName: "mixtral", TotalTokens: 500, Duration: 1, StopReason: "stop", Timestamp: day},
+	}
+	for _, entry := range entries {
+		if err := WriteLogEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	prices := Config{Prices: map[string]ModelPrice{"gpt-4o": {Input: 1, Output: 3}}}.PriceTable()
+	rows, total, err := LogStats(LogFilter{}, "model", "", prices)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || rows[0].Group != "gpt-4o-2024-08-06" {
+		t.Fatalf("Expected a row per model, got %+v", rows)
+	}
+
+	gpt := rows[0]
+	if gpt.Calls != 3 || gpt.TotalTokens != 6000 || gpt.P50Duration != 2 || gpt.P95Duration != 3 {
+		t.Errorf("Unexpected stats %+v", gpt)
+	}
+	if gpt.StopReasons["stop"] != 2 || gpt.StopReasons["length"] != 1 {
+		t.Errorf("Unexpected stop reasons %v", gpt.StopReasons)
+	}
+	// The config's price, at the mean of input and output
+	if gpt.Cost < 0.01199 || gpt.Cost > 0.01201 {
+		t.Errorf("Expected a cost of $0.012, got %v", gpt.Cost)
+	}
+	if total.Calls != 5 || total.UnpricedCalls != 1 || rows[1].Cost != 0 || rows[1].UnpricedCalls != 0 {
+		t.Errorf("Expected Ollama to be free and Groq unpriced, got %+v and %+v", rows[1], total)
+	}
+
+	rows, _, err = LogStats(LogFilter{Model: "gpt"}, "provider", "day", prices)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].Period != "2025-05-01" || rows[0].Group != "ChatGPT" || rows[0].Calls != 2 {
+		t.Errorf("Expected ChatGPT per day, got %+v", rows)
+	}
+
+	var out bytes.Buffer
+	if err := PrintStatsTable(&out, rows, total, "provider"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), "PERIOD") || !strings.Contains(out.String(), "leaves out 1 call ") {
+		t.Errorf("Unexpected table\n%s", out.String())
+	}
+}
+
+func TestLookupPrice(t *testing.T) {
+	prices := Config{}.PriceTable()
+
+	cases := map[string]float64{
+		"gpt-4o-2024-08-06":      2.50,
+		"gpt-4o-mini-2024-07-18": 0.15,
+		"models/gemini-2.5-pro":  1.25,
+	}
+	for model, input := range cases {
+		if price, ok := LookupPrice(prices, model); !ok || price.Input != input {
+			t.Errorf("LookupPrice(%q) = %+v, %v, want input %v", model, price, ok, input)
+		}
+	}
+	if _, ok := LookupPrice(prices, "mixtral"); ok {
+		t.Error("Expected no price for an unknown model")
+	}
+}
+
+func TestEntryCostSplit(t *testing.T) {
+	prices := map[string]ModelPrice{"gpt-4o": {Input: 2, Output: 10, Cached: 1}, "mixtral": {Input: 1, Output: 1}}
+
+	entry := LogEntry{ModelName: "gpt-4o", TotalTokens: 2000, PromptTokens: 1500, CachedTokens: 1000, CompletionTokens: 500}
+	// 500 uncached at $2, 1000 cached at $1 and 500 out at $10 per million
+	if cost, ok := EntryCost(prices, entry); !ok || cost < 0.006999 || cost > 0.007001 {
+		t.Errorf("Expected $0.007, got %v", cost)
+	}
+
+	// Without a cached price the cached tokens cost the same as the rest
+	entry = LogEntry{ModelName: "mixtral", TotalTokens: 2000, PromptTokens: 1500, CachedTokens: 1000, CompletionTokens: 500}
+	if cost, ok := EntryCost(prices, entry); !ok || cost < 0.001999 || cost > 0.002001 {
+		t.Errorf("Expected $0.002, got %v", cost)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StreamPrinter lets several providers stream at once without their tokens
+// interleaving: the first to start writes straight to the terminal and the
+// others are buffered, taking their turn once the one ahead has finished
+type StreamPrinter struct {
+	mu      sync.Mutex
+	out     io.Writer
+	owner   string
+	queue   []string
+	buffers map[string]*strings.Builder
+	done    map[string]bool
+}
+
+func NewStreamPrinter(out io.Writer) *StreamPrinter {
+	return &StreamPrinter{
+		out:     out,
+		buffers: map[string]*strings.Builder{},
+		done:    map[string]bool{},
+	}
+}
+
+// Write prints text for the named stream, or buffers it if another stream
+// has the terminal
+func (sp *StreamPrinter) Write(name string, text string) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	if sp.owner == "" {
+		sp.owner = name
+	}
+
+	if sp.owner == name {
+		fmt.Fprint(sp.out, text)
+		return
+	}
+
+	if _, ok := sp.buffers[name]; !ok {
+		sp.buffers[name] = &strings.Builder{}
+		sp.queue = append(sp.queue, name)
+	}
+	sp.buffers[name].WriteString(text)
+}
+
+// Finish marks the named stream as complete and hands the terminal to the
+// next stream in line, flushing what it has buffered so far
+func (sp *StreamPrinter) Finish(name string) {
+	sp.mu.Lock()
+	defer sp.mu.Unlock()
+
+	if sp.owner != name {
+		sp.done[name] = true
+		return
+	}
+
+	sp.owner = ""
+	for len(sp.queue) > 0 {
+		next := sp.queue[0]
+		sp.queue = sp.queue[1:]
+
+		fmt.Fprint(sp.out, sp.buffers[next].String())
+		delete(sp.buffers, next)
+
+		if !sp.done[next] {
+			sp.owner = next
+			return
+		}
+	}
+}
+
+// FmtStreamTrailer formats what follows streamed content: the status line
+// and any citations
+func FmtStreamTrailer(response ModelResponse, duration time.Duration, quietMode bool) string {
+	var out string
+
+	if len(response.Citations) > 0 {
+		out += "\n\nCitations:\n\n"
+		for idx, citation := range response.Citations {
+			out += fmt.Sprintf("%d. %s\n", idx+1, citation)
+		}
+	}
+
+	if extras := fmtSearchExtras(response); extras != "" {
+		out += "\n\n" + strings.TrimSuffix(extras, "\n")
+	}
+
+	if !quietMode {
+		out += fmt.Sprintf("\n\nModel: %s, %s, finished due to: %s, ", response.Model, fmtTokens(response), response.FinishReason)
+		if response.SafetyRating != "" {
+			out += fmt.Sprintf("safety rating: %s, ", response.SafetyRating)
+		}
+		out += fmt.Sprintf("duration: %.3f seconds", duration.Seconds())
+	}
+
+	return out + "\n\n"
+}
+
+// StreamProvider is the streaming counterpart of CompleteProvider: tokens go
+// to the printer as they arrive and the assembled response is logged at the
+// end and returned
+func StreamProvider(ctx context.Context, p Provider, req Request, logToJsonl bool, quietMode bool, printer *StreamPrinter) (ModelResponse, error) {
+	name := p.Name()
+	defer printer.Finish(name)
+
+	if !quietMode {
+		printer.Write(name, fmt.Sprintf("# %s\n\n", name))
+	}
+
+	// What we've printed so far, kept in case we're cancelled part way through
+	var partial strings.Builder
+	onToken := func(token string) {
+		partial.WriteString(token)
+		printer.Write(name, token)
+	}
+
+	fromTime := time.Now()
+
+	var response ModelResponse
+	stats, err := Retry(ctx, retryPolicy, func() error {
+		var err error
+		streamer, ok := p.(Streamer)
+		if ok && !req.Mock {
+			response, err = streamer.Stream(ctx, req, onToken)
+		} else {
+			// Mocks and providers which can't stream come back all in one go
+			response, err = p.Complete(ctx, req)
+			if err == nil {
+				onToken(response.Content)
+			}
+		}
+
+		// Once tokens are on the screen we can't take them back, so a
+		// stream which fails part way through isn't retried
+		if err != nil && partial.Len() > 0 {
+			return Permanent(err)
+		}
+		return err
+	})
+
+	if cause := cancelCause(ctx); err != nil && cause != nil {
+		printer.Write(name, fmt.Sprintf("\n\n[%s: %v]\n\n", StopReasonCancelled, cause))
+		response = ModelResponse{Model: req.Model, Content: partial.String(), FinishReason: StopReasonCancelled}
+		if logToJsonl {
+			logModelCall(p, req, response, time.Since(fromTime), stats)
+		}
+		return response, cause
+	}
+
+	if err != nil {
+		if !quietMode {
+			printer.Write(name, fmt.Sprintf("\n\nFailed: %v\n\n", err))
+		}
+		return ModelResponse{}, err
+	}
+
+	duration := time.Since(fromTime)
+
+	if logToJsonl {
+		logModelCall(p, req, response, duration, stats)
+	}
+
+	printer.Write(name, FmtStreamTrailer(response, duration, quietMode))
+	return response, nil
+}
+
+// readSSE reads a server-sent event stream, calling onEvent with the event
+// name (which may be empty) and data of each event
+func readSSE(r io.Reader, onEvent func(event string, data string) error) error {
+	scanner := bufio.NewScanner(r)
+	// Events can be larger than the default 64KB token limit
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+
+	var event string
+	var data []string
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// A blank line dispatches the event
+		if line == "" {
+			if len(data) > 0 {
+				if err := onEvent(event, strings.Join(data, "\n")); err != nil {
+					return err
+				}
+			}
+			event, data = "", nil
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	// Flush anything left if the stream didn't end with a blank line
+	if len(data) > 0 {
+		return onEvent(event, strings.Join(data, "\n"))
+	}
+
+	return nil
+}
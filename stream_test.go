@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestStreamPrinter(t *testing.T) {
+	var out strings.Builder
+	sp := NewStreamPrinter(&out)
+
+	sp.Write("a", "a1 ")
+	sp.Write("b", "b1 ")
+	sp.Write("c", "c1 ")
+	sp.Write("a", "a2 ")
+	sp.Finish("c")
+	sp.Write("b", "b2 ")
+	sp.Finish("a")
+	sp.Write("b", "b3 ")
+	sp.Finish("b")
+
+	// a has the terminal first, then b flushes and carries on, then c which
+	// finished while waiting
+	expected := "a1 a2 b1 b2 b3 c1 "
+	if out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestReadSSE(t *testing.T) {
+	stream := "event: ping\ndata: {}\n\n: comment\ndata: line one\ndata: line two\n\ndata: [DONE]"
+
+	var events, data []string
+	err := readSSE(strings.NewReader(stream), func(event string, d string) error {
+		events = append(events, event)
+		data = append(data, d)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(data) != 3 {
+		t.Fatalf("Expected 3 events, got %d: %q", len(data), data)
+	}
+	if events[0] != "ping" || data[1] != "line one\nline two" || data[2] != "[DONE]" {
+		t.Errorf("Unexpected events %q with data %q", events, data)
+	}
+}
+
+func TestStreamProviderMock(t *testing.T) {
+	var out strings.Builder
+	sp := NewStreamPrinter(&out)
+
+	response, err := StreamProvider(context.Background(), chatGPTProvider{}, Request{Prompt: "Mock prompt", Mock: true}, false, true, sp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(response.Content, "This is a mocked ChatGPT response.") {
+		t.Errorf("Expected the assembled response back, got %q", response.Content)
+	}
+
+	if !strings.HasPrefix(out.String(), "This is a mocked ChatGPT response.") {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// systemOptions are the ways of giving a system prompt on the command line,
+// of which only one can be used at a time
+type systemOptions struct {
+	text    string
+	file    string
+	persona string
+}
+
+// Resolve returns the system prompt given on the command line, or "" if none
+// was given
+func (o systemOptions) Resolve(cfg Config) (string, error) {
+	given := 0
+	for _, each := range []string{o.text, o.file, o.persona} {
+		if each != "" {
+			given++
+		}
+	}
+	if given > 1 {
+		return "", fmt.Errorf("only one of --system, --system-file and --persona can be used")
+	}
+
+	switch {
+	case o.file != "":
+		system, err := os.ReadFile(o.file)
+		if err != nil {
+			return "", fmt.Errorf("failed to read system prompt: %w", err)
+		}
+		return strings.TrimSpace(string(system)), nil
+
+	case o.persona != "":
+		for name, system := range cfg.Personas {
+			if strings.EqualFold(name, o.persona) {
+				return system, nil
+			}
+		}
+		return "", fmt.Errorf("unknown persona %q, the config has %s", o.persona, personaNames(cfg))
+	}
+
+	return o.text, nil
+}
+
+// personaNames lists the personas in the config, for error messages
+func personaNames(cfg Config) string {
+	if len(cfg.Personas) == 0 {
+		return "none"
+	}
+
+	names := make([]string, 0, len(cfg.Personas))
+	for name := range cfg.Personas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// SystemPromptFor returns the system prompt to send to p: the one given on
+// the command line, then the provider's own, then the config's
+func SystemPromptFor(p Provider, given string, cfg Config) string {
+	if given != "" {
+		return given
+	}
+	if prompter, ok := p.(SystemPrompter); ok {
+		return prompter.SystemPrompt()
+	}
+	return cfg.SystemPrompt
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSystemOptionsResolve(t *testing.T) {
+	cfg := Config{Personas: map[string]string{"reviewer": "You review Go code."}}
+
+	if system, err := (systemOptions{persona: "Reviewer"}).Resolve(cfg); err != nil || system != "You review Go code." {
+		t.Errorf("Expected the reviewer persona, got %q (%v)", system, err)
+	}
+	if _, err := (systemOptions{persona: "poet"}).Resolve(cfg); err == nil {
+		t.Error("Expected an error for an unknown persona")
+	}
+	if _, err := (systemOptions{text: "Be brief", persona: "reviewer"}).Resolve(cfg); err == nil {
+		t.Error("Expected an error for --system with --persona")
+	}
+
+	systemFile := filepath.Join(t.TempDir(), "system.md")
+	if err := os.WriteFile(systemFile, []byte("Answer in French.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if system, err := (systemOptions{file: systemFile}).Resolve(cfg); err != nil || system != "Answer in French." {
+		t.Errorf("Expected the system file, got %q (%v)", system, err)
+	}
+}
+
+func TestSystemPromptFor(t *testing.T) {
+	cfg := Config{SystemPrompt: "From the config"}
+
+	if system := SystemPromptFor(chatGPTProvider{}, "", cfg); system != "From the config" {
+		t.Errorf("Expected the config's system prompt, got %q", system)
+	}
+	if system := SystemPromptFor(chatGPTProvider{}, "Given", cfg); system != "Given" {
+		t.Errorf("Expected the given system prompt, got %q", system)
+	}
+	if system := SystemPromptFor(perplexityProvider{}, "", cfg); system != perplexityOptions.SystemPrompt {
+		t.Errorf("Expected Perplexity's own system prompt, got %q", system)
+	}
+}
+
+func TestChatCompletionParamsSystem(t *testing.T) {
+	params := ChatCompletionParams(Request{Prompt: "Hi", System: "Be brief"}, "gpt-test")
+	if len(params.Messages) != 2 || params.Messages[0].OfSystem == nil || params.Messages[1].OfUser == nil {
+		t.Errorf("Expected a system message then the prompt, got %+v", params.Messages)
+	}
+
+	params = ChatCompletionParams(Request{Prompt: "Hi"}, "gpt-test")
+	if len(params.Messages) != 1 {
+		t.Errorf("Expected just the prompt, got %+v", params.Messages)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// defaultTimeout is how long a provider gets unless --timeout says otherwise
+const defaultTimeout = 5 * time.Minute
+
+// StopReasonCancelled is logged as the stop reason of calls cut short by
+// Ctrl-C or a timeout
+const StopReasonCancelled = "cancelled"
+
+// httpClient is used by the providers which talk HTTP themselves. It
+// deliberately has no Timeout: deadlines come from the request's context, so
+// they can differ per provider and Ctrl-C cancels everything in flight
+var httpClient = &http.Client{}
+
+// ParseTimeoutFlag parses a --timeout value into timeouts, keyed by lower
+// case provider name. Like --model the value is either a bare duration, which
+// applies to every provider, or provider=duration pairs e.g. gemini=10m,ollama=30m.
+// A duration of 0 means no timeout
+func ParseTimeoutFlag(value string, timeouts map[string]time.Duration) error {
+	for _, each := range strings.Split(value, ",") {
+		each = strings.TrimSpace(each)
+		if each == "" {
+			continue
+		}
+
+		name, durationStr, found := strings.Cut(each, "=")
+		if !found {
+			name, durationStr = "", each
+		}
+
+		duration, err := time.ParseDuration(strings.TrimSpace(durationStr))
+		if err != nil || duration < 0 {
+			return fmt.Errorf("--timeout should be a duration like 90s or 5m, not %q", durationStr)
+		}
+
+		if !found {
+			timeouts[""] = duration
+			continue
+		}
+
+		p, ok := LookupProvider(strings.TrimSpace(name))
+		if !ok {
+			return fmt.Errorf("unknown provider %q in --timeout %s", name, value)
+		}
+		timeouts[strings.ToLower(p.Name())] = duration
+	}
+	return nil
+}
+
+// ResolveTimeout picks the timeout for p from the --timeout flag, falling
+// back to defaultTimeout
+func ResolveTimeout(p Provider, flagTimeouts map[string]time.Duration) time.Duration {
+	if timeout, ok := flagTimeouts[strings.ToLower(p.Name())]; ok {
+		return timeout
+	}
+	if timeout, ok := flagTimeouts[""]; ok {
+		return timeout
+	}
+	return defaultTimeout
+}
+
+// WithProviderTimeout gives p its own deadline under ctx; a timeout of 0
+// means none
+func WithProviderTimeout(ctx context.Context, p Provider, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	cause := fmt.Errorf("%s timed out after %s", p.Name(), timeout)
+	return context.WithTimeoutCause(ctx, timeout, cause)
+}
+
+// errInterrupted is why everything stops when Ctrl-C is pressed
+var errInterrupted = errors.New("interrupted")
+
+// InterruptContext returns a context which is cancelled when Ctrl-C is
+// pressed, so in-flight requests stop and we can report what we have. A
+// second Ctrl-C exits straight away as usual
+func InterruptContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(parent)
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		select {
+		case <-sigs:
+			cancel(errInterrupted)
+		case <-ctx.Done():
+		}
+		signal.Stop(sigs)
+	}()
+
+	return ctx, func() { cancel(nil) }
+}
+
+// cancelCause returns why ctx was cancelled or timed out, or nil if it
+// wasn't. SDKs report this in their own ways so this is what we show instead
+func cancelCause(ctx context.Context) error {
+	if ctx.Err() == nil {
+		return nil
+	}
+	return context.Cause(ctx)
+}
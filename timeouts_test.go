@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTimeoutFlag(t *testing.T) {
+	timeouts := map[string]time.Duration{}
+	if err := ParseTimeoutFlag("90s,ollama=30m,gemini=0", timeouts); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := ResolveTimeout(ollamaProvider{}, timeouts); got != 30*time.Minute {
+		t.Errorf("Expected 30m for Ollama, got %v", got)
+	}
+	if got := ResolveTimeout(geminiProvider{}, timeouts); got != 0 {
+		t.Errorf("Expected no timeout for Gemini, got %v", got)
+	}
+	if got := ResolveTimeout(chatGPTProvider{}, timeouts); got != 90*time.Second {
+		t.Errorf("Expected 90s for ChatGPT, got %v", got)
+	}
+	if got := ResolveTimeout(chatGPTProvider{}, map[string]time.Duration{}); got != defaultTimeout {
+		t.Errorf("Expected the default timeout, got %v", got)
+	}
+
+	for _, bad := range []string{"soon", "nope=5m", "-5s"} {
+		if err := ParseTimeoutFlag(bad, map[string]time.Duration{}); err == nil {
+			t.Errorf("Expected an error for %q", bad)
+		}
+	}
+}
+
+func TestCompleteProviderTimeout(t *testing.T) {
+	t.Setenv(anthropicApiKey, "test-api-key")
+
+	// Never answers. Reading the body means we see the client hang up
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	t.Setenv(anthropicBaseURLEnv, server.URL)
+
+	ctx, cancel := WithProviderTimeout(context.Background(), anthropicProvider{}, 50*time.Millisecond)
+	defer cancel()
+
+	_, _, err := CompleteProvider(ctx, anthropicProvider{}, Request{Prompt: "Hi"}, false)
+	if err == nil || !strings.Contains(err.Error(), "timed out after 50ms") {
+		t.Errorf("Expected a timeout, got %v", err)
+	}
+}
+
+func TestStreamProviderCancelledKeepsPartial(t *testing.T) {
+	t.Setenv(anthropicApiKey, "test-api-key")
+
+	// Starts answering then hangs
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte(`event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hello "}}
+
+`))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	t.Setenv(anthropicBaseURLEnv, server.URL)
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	time.AfterFunc(100*time.Millisecond, func() { cancel(errInterrupted) })
+
+	var out strings.Builder
+	_, err := StreamProvider(ctx, anthropicProvider{}, Request{Prompt: "Hi"}, false, true, NewStreamPrinter(&out))
+	if err != errInterrupted {
+		t.Errorf("Expected %v, got %v", errInterrupted, err)
+	}
+	if !strings.HasPrefix(out.String(), "Hello ") || !strings.Contains(out.String(), "[cancelled: interrupted]") {
+		t.Errorf("Unexpected output %q", out.String())
+	}
+}